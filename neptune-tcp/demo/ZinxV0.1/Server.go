@@ -1,12 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"neptune-golang/neptune-tcp/zinx/znet"
 )
 
 func main() {
 	// 1. 创建服务器对象
-	server := znet.NewServer()
+	server, err := znet.NewServer()
+	if err != nil {
+		fmt.Println("[zinx] create server err", err)
+		return
+	}
 	// 2. 调用服务器方法
 	server.Serve()
 }
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"neptune-golang/neptune-tcp/demo/ZinxV0.7/server/router"
 	"neptune-golang/neptune-tcp/zinx/znet"
 )
 
 func main() {
 	// 1. 创建服务器对象
-	server := znet.NewServer()
+	server, err := znet.NewServer(znet.WithConfigFile("config/zinx.json"))
+	if err != nil {
+		fmt.Println("[zinx] create server err", err)
+		return
+	}
 	// 2. 调用服务器方法
 	server.AddRouter(1, &router.PingHandler{})
 	server.AddRouter(2, &router.HelloHandler{})
@@ -2,59 +2,51 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"math/rand"
-	"neptune-go/src/zinx/znet"
-	"net"
+	"neptune-golang/neptune-tcp/zinx/znet"
 	"time"
 )
 
+// EchoRequest 和服务器的类型化路由保持一致
+type EchoRequest struct {
+	Text string `json:"text"`
+}
+
+type EchoResponse struct {
+	Text string `json:"text"`
+}
+
 func main() {
 	fmt.Println("client start...")
 
 	time.Sleep(time.Second)
 	// 1. 连接服务器
-	conn, err := net.Dial("tcp", "127.0.0.1:2333")
-	if err != nil {
+	client := znet.NewClient("127.0.0.1", 2333)
+	if err := client.Dial(); err != nil {
 		fmt.Println("client start err")
 		return
 	}
+	defer client.Close()
 	// 2. 向服务器发送数据
 	var count uint32 = 0
 	for {
 		count++
-		// 2.1 获取编解码器
-		codec := znet.NewCodec()
-		// 2.2 发送数据
-		message := znet.NewMessage(uint32(rand.Intn(2)+1), []byte("ZinxV0.9"))
-		buf, err := codec.Encode(message)
+		// 2.1 发送数据并等待响应
+		response, err := client.Call(uint32(rand.Intn(2)+1), []byte("ZinxV0.9"), 3*time.Second)
 		if err != nil {
-			fmt.Println("[zinx] write encode buf err ", err)
-			return
-		}
-		if _, err := conn.Write(buf); err != nil {
-			fmt.Println("[zinx] write buf err", err)
-			return
+			fmt.Println("[zinx] client call err", err)
+			time.Sleep(time.Second)
+			continue
 		}
-		// 2.3 接收数据
-		headBuf := make([]byte, codec.GetHeadLength())
-		if _, err := io.ReadFull(conn, headBuf); err != nil {
-			fmt.Println("[zinx] read head buf err", err)
-			return
-		}
-		response, err := codec.Decode(headBuf)
+
+		fmt.Printf("%d server call back %s, length=%d\n", count, response.GetMessageData(), response.GetMessageLength())
+		// 2.2 类型化调用: 自动序列化请求和反序列化响应
+		echo, err := znet.CallTyped[EchoRequest, EchoResponse](client, 3, &EchoRequest{Text: "ZinxV0.9"}, 3*time.Second)
 		if err != nil {
-			fmt.Println("[zinx] read decode head buf err", err)
-			return
+			fmt.Println("[zinx] client call typed err", err)
+		} else {
+			fmt.Printf("%d server echo %s\n", count, echo.Text)
 		}
-		dataBuf := make([]byte, response.GetMessageLength())
-		if _, err := io.ReadFull(conn, dataBuf); err != nil {
-			fmt.Println("[zinx] read body buf err", err)
-			return
-		}
-		response.SetMessageData(dataBuf)
-
-		fmt.Printf("%d server call back %s, length=%d\n", count, buf, response.GetMessageLength())
 
 		time.Sleep(time.Second)
 	}
@@ -5,6 +5,7 @@ import (
 	"neptune-golang/neptune-tcp/demo/ZinxV0.9/server/router"
 	"neptune-golang/neptune-tcp/zinx/ziface"
 	"neptune-golang/neptune-tcp/zinx/znet"
+	"time"
 )
 
 func NeptuneOnConnStart(connection ziface.IConnection) {
@@ -18,15 +19,20 @@ func NeptuneOnConnStop(connection ziface.IConnection) {
 	if err := connection.SendMessage(2, []byte("[zinx] on conn stop hook")); err != nil {
 		fmt.Println("[zinx] on conn stop hook fail")
 	}
-	fmt.Println("[zinx] on conn stop hook success")
+	fmt.Println("[zinx] on conn stop hook success, reason:", connection.GetCloseReason())
 }
 
 func main() {
 	// 1. 创建服务器对象
-	server := znet.NewServer()
+	server, err := znet.NewServer(znet.WithConfigFile("config/zinx.json"), znet.WithConfigWatch(5*time.Second))
+	if err != nil {
+		fmt.Println("[zinx] create server err", err)
+		return
+	}
 	// 2. 调用服务器方法
 	server.AddRouter(1, &router.PingHandler{})
 	server.AddRouter(2, &router.HelloHandler{})
+	znet.AddTypedRouter(server, 3, router.Echo)
 	server.SetOnConnStart(NeptuneOnConnStart)
 	server.SetOnConnStop(NeptuneOnConnStop)
 	server.Serve()
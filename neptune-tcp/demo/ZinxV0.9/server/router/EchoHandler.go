@@ -0,0 +1,26 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"neptune-golang/neptune-tcp/zinx/znet"
+)
+
+// EchoRequest 类型化路由的请求: 默认使用 JSON 序列化
+type EchoRequest struct {
+	Text string `json:"text"`
+}
+
+// EchoResponse 类型化路由的响应
+type EchoResponse struct {
+	Text string `json:"text"`
+}
+
+// Echo 类型化处理函数: 不需要手动解析消息内容
+func Echo(ctx context.Context, request *EchoRequest) (*EchoResponse, error) {
+	if request.Text == "" {
+		return nil, znet.NewStatusError(znet.CodeBadRequest, "text is empty")
+	}
+	fmt.Println("[zinx] echo handler text=", request.Text)
+	return &EchoResponse{Text: "echo handler: " + request.Text}, nil
+}
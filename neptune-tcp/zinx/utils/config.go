@@ -2,18 +2,69 @@ package utils
 
 import (
 	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"neptune-golang/neptune-tcp/zinx/ziface"
+	"os"
+	"reflect"
+)
+
+const (
+	// DispatchModeHash 按照连接 ID 选择消息队列: 同一个连接的消息按照顺序处理
+	DispatchModeHash = "hash"
+	// DispatchModeRoundRobin 轮询选择消息队列
+	DispatchModeRoundRobin = "roundrobin"
+	// DispatchModeLeastLoaded 选择积压请求最少的消息队列
+	DispatchModeLeastLoaded = "leastloaded"
+	// DispatchModeInline 不使用工作协程池, 直接在读协程中处理
+	DispatchModeInline = "inline"
+)
+
+const (
+	// SendQueuePolicyDrop 发送队列已满时丢弃消息并返回错误
+	SendQueuePolicyDrop = "drop"
+	// SendQueuePolicyBlock 发送队列已满时阻塞等待
+	SendQueuePolicyBlock = "block"
+	// SendQueuePolicyDisconnect 发送队列已满时断开慢速连接
+	SendQueuePolicyDisconnect = "disconnect"
+)
+
+const (
+	// NetworkModeGoroutine 每个连接使用独立的读写协程
+	NetworkModeGoroutine = "goroutine"
+	// NetworkModeEpoll 少量事件循环通过 epoll 读取所有连接, 只支持 Linux
+	NetworkModeEpoll = "epoll"
+)
+
+const (
+	// RateLimitActionDrop 超过限流时丢弃消息
+	RateLimitActionDrop = "drop"
+	// RateLimitActionDelay 超过限流时暂停读取, 等待令牌后再处理
+	RateLimitActionDelay = "delay"
+	// RateLimitActionDisconnect 超过限流时断开连接
+	RateLimitActionDisconnect = "disconnect"
+)
+
+const (
+	// DuplicateLoginAllow 同一个用户可以同时有多个连接
+	DuplicateLoginAllow = "allow"
+	// DuplicateLoginKick 同一个用户再次登录时踢出旧的连接
+	DuplicateLoginKick = "kick"
+	// DuplicateLoginReject 同一个用户已经登录时拒绝新的连接
+	DuplicateLoginReject = "reject"
 )
 
 type Configuration struct {
 	// Server
-	Server    ziface.IServer
-	IP        string
+	IP string
+	// 网络类型: tcp, tcp4, tcp6, udp, udp4, udp6 (每个数据报是一条完整的消息), unix (Unix 域套接字)
 	IPVersion string
 	Port      uint32
 	Name      string
+	// Unix 域套接字的路径: IPVersion 为 unix 时使用
+	UnixSocketPath string
+
+	// TLS: 设置证书和私钥后启用 TLS, 设置客户端 CA 后要求客户端提供证书 (双向 TLS)
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
 
 	// Zinx
 	ZinxVersion        string
@@ -21,38 +72,137 @@ type Configuration struct {
 	ZinxMaxPackage     uint32
 	ZinxWorkerPoolSize uint32
 	ZinxTaskQueueSize  uint32
+	// 读空闲超时时间 (秒): 超过时间没有收到任何消息则触发空闲回调, 0 表示不检测; udp 没有断开的通知, 必须大于 0
+	ZinxIdleTimeout uint32
+	// 心跳消息 ID: 收到 ping 自动回复 pong, 0 表示不启用
+	ZinxHeartbeatID uint32
+	// 每个连接发送队列的长度
+	ZinxSendQueueSize uint32
+	// 发送队列已满时的策略: drop (丢弃并返回错误), block (阻塞等待), disconnect (断开慢速连接)
+	ZinxSendQueuePolicy string
+	// 写协程每次最多合并写入的消息数量, 0 或者 1 表示每条消息单独写入
+	ZinxWriteBatchSize uint32
+	// 写协程合并消息时最多等待的时间 (微秒), 0 表示只合并已经在发送队列中的消息, 不额外等待
+	ZinxWriteFlushInterval uint32
+	// 压缩算法: gzip, flate 或者注册的其他算法, 为空表示不压缩
+	ZinxCompression string
+	// 压缩协商消息 ID: 客户端协商之后才压缩, 旧客户端不受影响; 0 表示不协商, 所有连接直接压缩
+	ZinxCompressionID uint32
+	// 消息内容达到阈值 (字节) 时才压缩
+	ZinxCompressionThreshold uint32
+	// 认证超时时间 (秒): 设置认证器后, 超过时间没有完成认证则关闭连接, 0 表示不限制
+	ZinxAuthTimeout uint32
+	// 认证阶段最多处理的消息数量, 超过数量仍未完成认证则关闭连接
+	ZinxAuthMaxMessages uint32
+	// 同一个用户重复登录时的策略: allow (允许多个连接), kick (踢出旧的连接), reject (拒绝新的连接)
+	ZinxDuplicateLogin string
+	// 日志级别: debug, info, warn, error, off
+	ZinxLogLevel string
+	// 日志格式: text, json
+	ZinxLogFormat string
+	// 指标 HTTP 监听地址, 例如 127.0.0.1:9100, 以 Prometheus 文本格式输出 /metrics; 为空表示不启用
+	ZinxMetricsAddr string
+	// 任务分发策略: hash (按照连接 ID 分发, 保证同一个连接的消息有序), roundrobin, leastloaded, inline (不使用工作协程池)
+	ZinxDispatchMode string
+	// 网络模型: goroutine (每个连接两个协程), epoll (事件循环, 适合大量空闲连接)
+	ZinxNetworkMode string
+	// epoll 模式下事件循环的数量, 0 表示使用 CPU 核数
+	ZinxEventLoops uint32
+	// 限流 (令牌桶): 每秒允许的消息数量, 0 表示不限流; 突发容量为 0 时等于每秒消息数量
+	// 每个连接的限流
+	ZinxConnRateLimit uint32
+	ZinxConnRateBurst uint32
+	// 服务器所有连接共享的限流
+	ZinxServerRateLimit uint32
+	ZinxServerRateBurst uint32
+	// 按照消息 ID 限流: 消息 ID -> 每秒允许的消息数量, 每个连接独立计算
+	ZinxMessageRateLimits map[uint32]uint32
+	// 超过限流时的动作: drop (丢弃消息), delay (暂停读取), disconnect (断开连接)
+	ZinxRateLimitAction string
+	// 处理超时时间 (毫秒): 从收到消息开始计时, 超时后取消请求的上下文并执行超时的钩子函数, 0 表示不限制
+	ZinxHandlerTimeout uint32
+	// 按照消息 ID 设置处理超时时间 (毫秒), 覆盖 ZinxHandlerTimeout
+	ZinxHandlerTimeouts map[uint32]uint32
 }
 
-func (config *Configuration) Reload() {
+// NewConfiguration 创建默认配置: 不会读取任何文件
+func NewConfiguration() *Configuration {
+	return &Configuration{
+		Name:                     "ZinxServer",
+		IP:                       "0.0.0.0",
+		IPVersion:                "tcp4",
+		Port:                     8999,
+		ZinxVersion:              "V0.4",
+		ZinxMaxConn:              1000,
+		ZinxMaxPackage:           4096,
+		ZinxWorkerPoolSize:       10,
+		ZinxTaskQueueSize:        100,
+		ZinxDispatchMode:         DispatchModeHash,
+		ZinxNetworkMode:          NetworkModeGoroutine,
+		ZinxLogLevel:             "info",
+		ZinxLogFormat:            "text",
+		ZinxSendQueueSize:        64,
+		ZinxSendQueuePolicy:      SendQueuePolicyDrop,
+		ZinxWriteBatchSize:       32,
+		ZinxCompressionThreshold: 1024,
+		ZinxAuthTimeout:          10,
+		ZinxAuthMaxMessages:      3,
+		ZinxDuplicateLogin:       DuplicateLoginAllow,
+		ZinxIdleTimeout:          0,
+		ZinxHeartbeatID:          0,
+		ZinxRateLimitAction:      RateLimitActionDrop,
+	}
+}
+
+// LoadConfiguration 在默认配置的基础上读取配置文件
+func LoadConfiguration(path string) (*Configuration, error) {
+	config := NewConfiguration()
+	if err := config.Reload(path); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Reload 读取配置文件: 文件中没有出现的字段保持不变
+func (config *Configuration) Reload(path string) error {
 	// 1. 读取配置文件
-	data, err := ioutil.ReadFile("config/zinx.json")
+	data, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Println("[zinx] reload zinx config err", err)
-		return
+		return err
 	}
 	// 2. JSON -> Config
-	if err := json.Unmarshal(data, &Config); err != nil {
-		fmt.Println("[zinx] convert zinx config err", err)
-		return
+	return json.Unmarshal(data, config)
+}
+
+// Clone 复制配置, 每个服务器持有独立的配置
+func (config *Configuration) Clone() *Configuration {
+	clone := *config
+	// map 需要单独复制, 避免读取配置文件时修改原配置
+	clone.ZinxMessageRateLimits = cloneMap(config.ZinxMessageRateLimits)
+	clone.ZinxHandlerTimeouts = cloneMap(config.ZinxHandlerTimeouts)
+	return &clone
+}
+
+func cloneMap(source map[uint32]uint32) map[uint32]uint32 {
+	if source == nil {
+		return nil
+	}
+	clone := make(map[uint32]uint32, len(source))
+	for key, value := range source {
+		clone[key] = value
 	}
+	return clone
 }
 
-var Config *Configuration
-
-// 默认在导包的时候执行, 仅执行一次
-func init() {
-	// 1. 执行默认配置
-	Config = &Configuration{
-		Name:               "ZinxServer",
-		IP:                 "0.0.0.0",
-		IPVersion:          "tcp4",
-		Port:               8999,
-		ZinxVersion:        "V0.4",
-		ZinxMaxConn:        1000,
-		ZinxMaxPackage:     4096,
-		ZinxWorkerPoolSize: 10,
-		ZinxTaskQueueSize:  100,
+// Diff 比较两个配置, 返回取值不同的字段名称
+func (config *Configuration) Diff(other *Configuration) []string {
+	var fields []string
+	left := reflect.ValueOf(config).Elem()
+	right := reflect.ValueOf(other).Elem()
+	for index := 0; index < left.NumField(); index++ {
+		if !reflect.DeepEqual(left.Field(index).Interface(), right.Field(index).Interface()) {
+			fields = append(fields, left.Type().Field(index).Name)
+		}
 	}
-	// 2. 执行性自定义配置
-	Config.Reload()
+	return fields
 }
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := NewConfiguration().Validate(); err != nil {
+		t.Fatalf("default config invalid: %v", err)
+	}
+	for name, test := range map[string]struct {
+		modify  func(config *Configuration)
+		problem string
+	}{
+		"ip version":        {func(c *Configuration) { c.IPVersion = "ipx" }, "IPVersion"},
+		"unix path":         {func(c *Configuration) { c.IPVersion, c.UnixSocketPath = "unix", "" }, "UnixSocketPath"},
+		"port":              {func(c *Configuration) { c.Port = 70000 }, "Port"},
+		"tls key":           {func(c *Configuration) { c.TLSCertFile = "server.crt" }, "TLSCertFile"},
+		"max conn":          {func(c *Configuration) { c.ZinxMaxConn = 0 }, "ZinxMaxConn"},
+		"worker pool":       {func(c *Configuration) { c.ZinxWorkerPoolSize = 0 }, "ZinxWorkerPoolSize"},
+		"task queue":        {func(c *Configuration) { c.ZinxTaskQueueSize = 0 }, "ZinxTaskQueueSize"},
+		"send queue":        {func(c *Configuration) { c.ZinxSendQueueSize = 0 }, "ZinxSendQueueSize"},
+		"write batch":       {func(c *Configuration) { c.ZinxWriteBatchSize = 0 }, "ZinxWriteBatchSize"},
+		"dispatch mode":     {func(c *Configuration) { c.ZinxDispatchMode = "random" }, "ZinxDispatchMode"},
+		"send queue policy": {func(c *Configuration) { c.ZinxSendQueuePolicy = "wait" }, "ZinxSendQueuePolicy"},
+		"rate limit action": {func(c *Configuration) { c.ZinxRateLimitAction = "sleep" }, "ZinxRateLimitAction"},
+		"duplicate login":   {func(c *Configuration) { c.ZinxDuplicateLogin = "replace" }, "ZinxDuplicateLogin"},
+		"log level":         {func(c *Configuration) { c.ZinxLogLevel = "trace" }, "ZinxLogLevel"},
+		"udp idle":          {func(c *Configuration) { c.IPVersion = "udp4" }, "ZinxIdleTimeout"},
+		"udp delay": {func(c *Configuration) {
+			c.IPVersion, c.ZinxIdleTimeout, c.ZinxRateLimitAction = "udp4", 60, RateLimitActionDelay
+		}, "ZinxRateLimitAction delay"},
+		"udp inline": {func(c *Configuration) {
+			c.IPVersion, c.ZinxIdleTimeout, c.ZinxDispatchMode = "udp4", 60, DispatchModeInline
+		}, "ZinxDispatchMode inline"},
+		"epoll inline": {func(c *Configuration) {
+			c.ZinxNetworkMode, c.ZinxDispatchMode = NetworkModeEpoll, DispatchModeInline
+		}, "ZinxDispatchMode inline"},
+		"epoll delay": {func(c *Configuration) {
+			c.ZinxNetworkMode, c.ZinxRateLimitAction = NetworkModeEpoll, RateLimitActionDelay
+		}, "ZinxRateLimitAction delay"},
+	} {
+		config := NewConfiguration()
+		test.modify(config)
+		err := config.Validate()
+		if err == nil || !strings.Contains(err.Error(), test.problem) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+	// 所有问题一起返回
+	config := NewConfiguration()
+	config.ZinxMaxConn = 0
+	config.ZinxSendQueueSize = 0
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "ZinxMaxConn") || !strings.Contains(err.Error(), "ZinxSendQueueSize") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("TEST_ZINX_PORT", "2333")
+	t.Setenv("TEST_ZINX_MAX_CONN", "10")
+	t.Setenv("TEST_ZINX_TLS_CLIENT_CA_FILE", "ca.crt")
+	config := NewConfiguration()
+	if err := config.LoadEnv("TEST_ZINX_"); err != nil {
+		t.Fatal(err)
+	}
+	if config.Port != 2333 || config.ZinxMaxConn != 10 || config.TLSClientCAFile != "ca.crt" {
+		t.Fatalf("config = %d %d %q", config.Port, config.ZinxMaxConn, config.TLSClientCAFile)
+	}
+	t.Setenv("TEST_ZINX_PORT", "port")
+	if err := NewConfiguration().LoadEnv("TEST_ZINX_"); err == nil || !strings.Contains(err.Error(), "TEST_ZINX_PORT") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestBindFlags(t *testing.T) {
+	config := NewConfiguration()
+	flagSet := flag.NewFlagSet("zinx", flag.ContinueOnError)
+	if err := config.BindFlags(flagSet); err != nil {
+		t.Fatal(err)
+	}
+	if err := flagSet.Parse([]string{"-port", "2333", "-max-conn", "10", "-ip-version", "tcp6"}); err != nil {
+		t.Fatal(err)
+	}
+	if config.Port != 2333 || config.ZinxMaxConn != 10 || config.IPVersion != "tcp6" {
+		t.Fatalf("config = %d %d %q", config.Port, config.ZinxMaxConn, config.IPVersion)
+	}
+	// 参数名已经被注册时返回错误, 不会 panic
+	if err := NewConfiguration().BindFlags(flagSet); err == nil {
+		t.Fatal("redefined flag bound")
+	}
+}
+
+func TestApplyFlags(t *testing.T) {
+	flagSet := flag.NewFlagSet("zinx", flag.ContinueOnError)
+	if err := NewConfiguration().BindFlags(flagSet); err != nil {
+		t.Fatal(err)
+	}
+	if err := flagSet.Parse([]string{"-port", "2333"}); err != nil {
+		t.Fatal(err)
+	}
+	// 只写入命令行中出现的参数, 其他字段保持不变
+	config := NewConfiguration()
+	config.ZinxMaxConn = 10
+	if err := config.ApplyFlags(flagSet); err != nil {
+		t.Fatal(err)
+	}
+	if config.Port != 2333 || config.ZinxMaxConn != 10 {
+		t.Fatalf("config = %d %d", config.Port, config.ZinxMaxConn)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zinx.json")
+	if err := os.WriteFile(path, []byte(`{"Port": 2333, "ZinxHandlerTimeouts": {"1": 10}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfiguration(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 文件中没有出现的字段保持默认值
+	if config.Port != 2333 || config.ZinxMaxConn != 1000 || config.ZinxHandlerTimeouts[1] != 10 {
+		t.Fatalf("config = %d %d %v", config.Port, config.ZinxMaxConn, config.ZinxHandlerTimeouts)
+	}
+}
+
+func TestCloneAndDiff(t *testing.T) {
+	config := NewConfiguration()
+	config.ZinxHandlerTimeouts = map[uint32]uint32{1: 10}
+	clone := config.Clone()
+	if fields := config.Diff(clone); len(fields) != 0 {
+		t.Fatalf("clone diff = %v", fields)
+	}
+	// 修改副本不影响原配置, 包括 map
+	clone.Port = 2333
+	clone.ZinxHandlerTimeouts[1] = 20
+	clone.ZinxMessageRateLimits = map[uint32]uint32{1: 5}
+	if config.ZinxHandlerTimeouts[1] != 10 {
+		t.Fatal("clone shares map with original")
+	}
+	want := []string{"Port", "ZinxMessageRateLimits", "ZinxHandlerTimeouts"}
+	if fields := config.Diff(clone); !reflect.DeepEqual(fields, want) {
+		t.Fatalf("diff = %v, want %v", fields, want)
+	}
+}
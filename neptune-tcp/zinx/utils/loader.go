@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// LoadEnv 读取环境变量: 变量名为前缀加上字段名的大写下划线形式, 字段名的 Zinx 前缀会被去掉
+// 例如前缀为 ZINX_ 时, Port 对应 ZINX_PORT, ZinxMaxConn 对应 ZINX_MAX_CONN
+func (config *Configuration) LoadEnv(prefix string) error {
+	return config.eachField(func(name string, field reflect.Value) error {
+		value, ok := os.LookupEnv(prefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_")))
+		if !ok {
+			return nil
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("[zinx] env %s%s: %w", prefix, strings.ToUpper(strings.ReplaceAll(name, "-", "_")), err)
+		}
+		return nil
+	})
+}
+
+// BindFlags 注册命令行参数: 参数名为字段名的小写中划线形式, 例如 -port, -max-conn
+// 解析命令行参数后直接写入配置; 参数名已经被注册时返回错误
+func (config *Configuration) BindFlags(flagSet *flag.FlagSet) error {
+	return config.eachField(func(name string, field reflect.Value) error {
+		if flagSet.Lookup(name) != nil {
+			return fmt.Errorf("[zinx] flag -%s already defined", name)
+		}
+		flagSet.Var(&fieldValue{field: field}, name, "zinx "+name)
+		return nil
+	})
+}
+
+// ApplyFlags 把命令行中出现的参数写入配置: 参数需要由 BindFlags 注册, 可以重复应用到新的配置
+// 例如替换配置或者重新加载配置文件之后, 命令行参数仍然优先
+func (config *Configuration) ApplyFlags(flagSet *flag.FlagSet) (err error) {
+	fields := make(map[string]reflect.Value)
+	_ = config.eachField(func(name string, field reflect.Value) error {
+		fields[name] = field
+		return nil
+	})
+	flagSet.Visit(func(f *flag.Flag) {
+		field, ok := fields[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		if setErr := setField(field, f.Value.String()); setErr != nil {
+			err = fmt.Errorf("[zinx] flag -%s: %w", f.Name, setErr)
+		}
+	})
+	return err
+}
+
+// eachField 遍历可以从外部设置的字段: 字符串和无符号整数
+func (config *Configuration) eachField(fn func(name string, field reflect.Value) error) error {
+	value := reflect.ValueOf(config).Elem()
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Field(index)
+		if field.Kind() != reflect.String && field.Kind() != reflect.Uint32 {
+			continue
+		}
+		name := toKebabCase(strings.TrimPrefix(value.Type().Field(index).Name, "Zinx"))
+		if err := fn(name, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Uint32:
+		number, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		field.SetUint(number)
+	}
+	return nil
+}
+
+// toKebabCase 驼峰转换为小写中划线: IPVersion -> ip-version, TLSClientCAFile -> tls-client-ca-file
+func toKebabCase(name string) string {
+	runes := []rune(name)
+	var builder strings.Builder
+	for index, r := range runes {
+		if index > 0 && unicode.IsUpper(r) {
+			previous := runes[index-1]
+			nextLower := index+1 < len(runes) && unicode.IsLower(runes[index+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextLower) {
+				builder.WriteByte('-')
+			}
+		}
+		builder.WriteRune(unicode.ToLower(r))
+	}
+	return builder.String()
+}
+
+// fieldValue 命令行参数和配置字段的绑定
+type fieldValue struct {
+	field reflect.Value
+}
+
+func (value *fieldValue) String() string {
+	if !value.field.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(value.field.Interface())
+}
+
+func (value *fieldValue) Set(s string) error {
+	return setField(value.field, s)
+}
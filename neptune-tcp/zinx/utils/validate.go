@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Validate 校验配置, 返回所有不合法的字段
+func (config *Configuration) Validate() error {
+	var problems []string
+	// 1. 服务器地址
+	switch config.IPVersion {
+	case "tcp", "tcp4", "tcp6":
+	case "udp", "udp4", "udp6":
+		if config.TLSCertFile != "" {
+			problems = append(problems, "TLS is not supported when IPVersion is udp")
+		}
+		if config.ZinxNetworkMode == NetworkModeEpoll {
+			problems = append(problems, "ZinxNetworkMode epoll is not supported when IPVersion is udp")
+		}
+		// 数据报没有断开连接的通知, 虚拟连接只能通过空闲检测释放
+		if config.ZinxIdleTimeout == 0 {
+			problems = append(problems, "ZinxIdleTimeout must be greater than 0 when IPVersion is udp")
+		}
+		// 所有虚拟连接共用一个读协程, 暂停读取或者在读协程中处理会阻塞所有客户端
+		if config.ZinxRateLimitAction == RateLimitActionDelay {
+			problems = append(problems, "ZinxRateLimitAction delay would block all sessions when IPVersion is udp")
+		}
+		if config.ZinxDispatchMode == DispatchModeInline {
+			problems = append(problems, "ZinxDispatchMode inline would block all sessions when IPVersion is udp")
+		}
+	case "unix":
+		if config.UnixSocketPath == "" {
+			problems = append(problems, "UnixSocketPath must be set when IPVersion is unix")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("IPVersion must be one of tcp, tcp4, tcp6, udp, udp4, udp6, unix, got %q", config.IPVersion))
+	}
+	if config.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("Port must be in [0, 65535], got %d", config.Port))
+	}
+	// 2. TLS 证书
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		problems = append(problems, "TLSCertFile and TLSKeyFile must be set together")
+	}
+	if config.TLSClientCAFile != "" && config.TLSCertFile == "" {
+		problems = append(problems, "TLSClientCAFile requires TLSCertFile and TLSKeyFile")
+	}
+	// 3. 连接和工作协程池
+	if config.ZinxMaxConn == 0 {
+		problems = append(problems, "ZinxMaxConn must be greater than 0")
+	}
+	switch config.ZinxDispatchMode {
+	case DispatchModeHash, DispatchModeRoundRobin, DispatchModeLeastLoaded:
+		if config.ZinxWorkerPoolSize == 0 {
+			problems = append(problems, fmt.Sprintf("ZinxWorkerPoolSize must be greater than 0 when ZinxDispatchMode is %q", config.ZinxDispatchMode))
+		}
+	case DispatchModeInline:
+	default:
+		problems = append(problems, fmt.Sprintf("ZinxDispatchMode must be one of hash, roundrobin, leastloaded, inline, got %q", config.ZinxDispatchMode))
+	}
+	if config.ZinxTaskQueueSize == 0 {
+		problems = append(problems, "ZinxTaskQueueSize must be greater than 0")
+	}
+	// 3.1 网络模型
+	switch config.ZinxNetworkMode {
+	case NetworkModeGoroutine:
+	case NetworkModeEpoll:
+		if runtime.GOOS != "linux" {
+			problems = append(problems, fmt.Sprintf("ZinxNetworkMode epoll is only supported on linux, got %s", runtime.GOOS))
+		}
+		if config.TLSCertFile != "" {
+			problems = append(problems, "ZinxNetworkMode epoll doesn't support TLS")
+		}
+		if config.ZinxRateLimitAction == RateLimitActionDelay {
+			problems = append(problems, "ZinxRateLimitAction delay would block the event loop when ZinxNetworkMode is epoll")
+		}
+		if config.ZinxDispatchMode == DispatchModeInline {
+			problems = append(problems, "ZinxDispatchMode inline would run handlers on the event loop when ZinxNetworkMode is epoll")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("ZinxNetworkMode must be goroutine or epoll, got %q", config.ZinxNetworkMode))
+	}
+	// 4. 发送队列
+	if config.ZinxSendQueueSize == 0 {
+		problems = append(problems, "ZinxSendQueueSize must be greater than 0")
+	}
+	if config.ZinxWriteBatchSize == 0 {
+		problems = append(problems, "ZinxWriteBatchSize must be greater than 0")
+	}
+	switch config.ZinxSendQueuePolicy {
+	case SendQueuePolicyDrop, SendQueuePolicyBlock, SendQueuePolicyDisconnect:
+	default:
+		problems = append(problems, fmt.Sprintf("ZinxSendQueuePolicy must be one of drop, block, disconnect, got %q", config.ZinxSendQueuePolicy))
+	}
+	// 4.1 压缩
+	if config.ZinxCompressionID != 0 && config.ZinxCompressionID == config.ZinxHeartbeatID {
+		problems = append(problems, fmt.Sprintf("ZinxCompressionID must be different from ZinxHeartbeatID, got %d", config.ZinxCompressionID))
+	}
+	// 4.2 限流
+	switch config.ZinxRateLimitAction {
+	case RateLimitActionDrop, RateLimitActionDelay, RateLimitActionDisconnect:
+	default:
+		problems = append(problems, fmt.Sprintf("ZinxRateLimitAction must be one of drop, delay, disconnect, got %q", config.ZinxRateLimitAction))
+	}
+	// 4.3 认证
+	if config.ZinxAuthMaxMessages == 0 {
+		problems = append(problems, "ZinxAuthMaxMessages must be greater than 0")
+	}
+	switch config.ZinxDuplicateLogin {
+	case DuplicateLoginAllow, DuplicateLoginKick, DuplicateLoginReject:
+	default:
+		problems = append(problems, fmt.Sprintf("ZinxDuplicateLogin must be one of allow, kick, reject, got %q", config.ZinxDuplicateLogin))
+	}
+	// 5. 日志
+	switch strings.ToLower(config.ZinxLogLevel) {
+	case "debug", "info", "warn", "warning", "error", "off", "none":
+	default:
+		problems = append(problems, fmt.Sprintf("ZinxLogLevel must be one of debug, info, warn, error, off, got %q", config.ZinxLogLevel))
+	}
+	switch strings.ToLower(config.ZinxLogFormat) {
+	case "text", "json":
+	default:
+		problems = append(problems, fmt.Sprintf("ZinxLogFormat must be text or json, got %q", config.ZinxLogFormat))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("[zinx] invalid config: " + strings.Join(problems, "; "))
+}
@@ -0,0 +1,16 @@
+package ziface
+
+// IIdentity 连接认证之后的身份: 应用可以定义自己的类型, 在处理器中通过类型断言获取
+type IIdentity interface {
+	// GetID 身份的唯一标识, 例如用户 ID
+	GetID() string
+}
+
+// IAuthenticator 认证器: 设置之后连接的前几条消息交给认证器处理, 认证通过之前不会交给路由器
+// 认证器在读协程 (或者事件循环) 中同步调用, 不要执行耗时过长的操作
+type IAuthenticator interface {
+	// Authenticate 处理一条认证消息, 可以通过 connection 回复对端:
+	// 返回身份表示认证通过; 返回错误表示认证失败, 连接会被关闭; 两者都为空表示需要继续认证 (例如挑战应答)
+	// 返回之后消息内容会被回收, 需要保留时先复制
+	Authenticate(connection IConnection, message IMessage) (IIdentity, error)
+}
@@ -0,0 +1,32 @@
+package ziface
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// IClient 客户端: 使用和服务器相同的编解码格式收发消息
+type IClient interface {
+	// Dial 连接服务器
+	Dial() error
+	// Close 断开连接, 不再自动重连
+	Close() error
+	// Send 发送消息
+	Send(id uint32, data []byte) error
+	// Call 发送消息并同步等待对应的响应
+	Call(id uint32, data []byte, timeout time.Duration) (IMessage, error)
+	// AddHandler 添加处理服务器推送消息的处理器: 处理器在单独的协程中按照收到的顺序执行, 可以在处理器中调用 Call
+	// 消息 ID 的最高两位保留给压缩标志和错误标志, 使用保留位时 panic
+	// 处理器阻塞时等待处理的消息会积压, 积压过多时读协程同样阻塞
+	AddHandler(id uint32, handler IHandler)
+	// SetTLSConfig 设置 TLS 配置, 需要在连接之前设置
+	SetTLSConfig(config *tls.Config)
+	// SetLogger 设置日志
+	SetLogger(logger ILogger)
+	// SetCodec 设置编解码器, 需要和服务器保持一致
+	SetCodec(codec ICodec)
+	// SetOnConnStart 设置连接建立 (包括重连成功) 的钩子函数
+	SetOnConnStart(func(connection IConnection))
+	// SetOnConnStop 设置连接断开的钩子函数
+	SetOnConnStop(func(connection IConnection))
+}
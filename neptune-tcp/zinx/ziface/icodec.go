@@ -3,7 +3,10 @@ package ziface
 type ICodec interface {
 	GetHeadLength() uint32
 
+	// Encode 编码消息: 返回的缓冲区归调用方所有, 连接写入之后不再引用, 不会放回缓冲池
+	// 同时实现 znet.BufferEncoder 的编解码器使用缓冲池, 连接写入之后放回
 	Encode(message IMessage) (data []byte, err error)
 
+	// Decode 解码头部: data 在返回之后会被复用, 返回的消息不能引用 data
 	Decode(data []byte) (message IMessage, err error)
 }
@@ -0,0 +1,11 @@
+package ziface
+
+// ICompressor 压缩算法: 同一个实例会被多个连接同时使用
+type ICompressor interface {
+	// Name 算法名称: 协商压缩时使用
+	Name() string
+	// Compress 压缩消息内容
+	Compress(data []byte) ([]byte, error)
+	// Decompress 解压消息内容: 解压后的长度超过 limit 时返回错误, limit 为 0 表示不限制
+	Decompress(data []byte, limit uint32) ([]byte, error)
+}
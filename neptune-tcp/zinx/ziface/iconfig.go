@@ -0,0 +1,9 @@
+package ziface
+
+// ConfigChange 热加载配置的结果
+type ConfigChange struct {
+	// 已经在运行时生效的字段
+	Applied []string
+	// 发生变化但是需要重启服务器才能生效的字段
+	RestartRequired []string
+}
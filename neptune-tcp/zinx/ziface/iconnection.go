@@ -1,21 +1,78 @@
 package ziface
 
-import "net"
+import (
+	"context"
+	"crypto/x509"
+	"net"
+)
+
+// ConnState 连接状态: 只会按照 connecting -> active -> closing -> closed 的顺序变化, 可以跳过 active
+type ConnState int32
+
+const (
+	// ConnStateConnecting 已经建立连接, 正在握手或者启动读写协程
+	ConnStateConnecting ConnState = iota
+	// ConnStateActive 正在收发消息
+	ConnStateActive
+	// ConnStateClosing 正在关闭: 执行关闭的钩子函数, 不再接收新的消息; 钩子函数中仍然可以发送消息
+	ConnStateClosing
+	// ConnStateClosed 已经关闭
+	ConnStateClosed
+)
+
+func (state ConnState) String() string {
+	switch state {
+	case ConnStateConnecting:
+		return "connecting"
+	case ConnStateActive:
+		return "active"
+	case ConnStateClosing:
+		return "closing"
+	case ConnStateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
 
 // IConnection 客户端连接处理器
 type IConnection interface {
 	// StartConn 建立连接
 	StartConn()
-	// StopConn 断开连接
+	// StopConn 断开连接, 可以在任意协程中多次调用, 只有第一次生效
 	StopConn()
-	// GetTCPConn 获取连接
+	// StopConnWithReason 断开连接并记录原因, 关闭的钩子函数中可以通过 GetCloseReason 获取
+	StopConnWithReason(reason error)
+	// GetState 获取连接状态
+	GetState() ConnState
+	// Done 连接关闭后关闭的管道
+	Done() <-chan struct{}
+	// GetCloseReason 获取关闭的原因, 连接没有关闭时返回 nil
+	GetCloseReason() error
+	// Context 获取连接的上下文: 连接关闭 (包括服务器停止) 时取消, context.Cause 返回关闭的原因
+	Context() context.Context
+	// GetTCPConn 获取 TCP 连接: 使用 TLS 时返回 nil
 	GetTCPConn() *net.TCPConn
+	// GetNetConn 获取底层连接: TCP 或者 TLS 连接
+	GetNetConn() net.Conn
+	// GetPeerCertificate 获取对端证书: 启用双向 TLS 时用于识别客户端身份, 否则返回 nil
+	GetPeerCertificate() *x509.Certificate
+	// GetIdentity 获取认证之后的身份: 没有设置认证器或者还没有完成认证时返回 nil
+	GetIdentity() IIdentity
 	// GetConnID 获取连接 ID
 	GetConnID() uint32
 	// RemoteAddr 获取客户端状态: 连接装填、IP 地址、端口号
 	RemoteAddr() net.Addr
-	// SendMessage 发送数据
+	// SendMessage 发送数据: 发送队列已满时按照配置的策略处理
 	SendMessage(id uint32, data []byte) error
+	// SendMessageBlocking 发送数据: 发送队列已满时阻塞等待, 直到 ctx 结束或者连接关闭
+	SendMessageBlocking(ctx context.Context, id uint32, data []byte) error
+	// SendHeartbeat 发送心跳探测消息, 对端会自动回复
+	SendHeartbeat() error
+	// Reply 回复请求: 携带请求的消息 ID 和序列号; 每个请求最多回复一次, 处理超时或者已经回复时返回错误
+	Reply(request IRequest, data []byte) error
+	// GetLogger 获取携带连接 ID 和客户端地址的日志
+	GetLogger() ILogger
 	// SetConnectionProperty 设置参数
 	SetConnectionProperty(key string, value interface{})
 	// GetConnectionProperty 获取参数
@@ -8,6 +8,38 @@ type IConnManager interface {
 	CloseConnection(connection IConnection)
 
 	GetConnectionCount() (count uint32)
+	// GetConnections 获取所有连接的快照
+	GetConnections() []IConnection
 
 	CloseConnections()
+
+	SetLogger(logger ILogger)
+
+	// Broadcast 向所有连接发送消息
+	Broadcast(id uint32, data []byte)
+	// BroadcastFilter 向满足条件的连接发送消息
+	BroadcastFilter(id uint32, data []byte, filter func(connection IConnection) bool)
+	// JoinGroup 连接加入分组, 连接关闭时自动离开所有分组
+	JoinGroup(group string, connection IConnection) error
+	// LeaveGroup 连接离开分组
+	LeaveGroup(group string, connection IConnection)
+	// SendToGroup 向分组内的所有连接发送消息
+	SendToGroup(group string, id uint32, data []byte) error
+	// GetGroupConnections 获取分组内的所有连接
+	GetGroupConnections(group string) []IConnection
+	// BindUser 连接绑定用户 ID, 连接关闭时自动解除绑定; 同一个用户已经有连接时按照重复登录策略处理
+	// 设置认证器时, 认证通过的连接自动绑定身份的 ID; 踢出的旧连接在单独的协程中关闭, 返回时可能还没有关闭
+	BindUser(userID string, connection IConnection) error
+	// UnbindUser 连接解除绑定用户 ID
+	UnbindUser(connection IConnection)
+	// GetUserConnections 获取用户的所有连接
+	GetUserConnections(userID string) []IConnection
+	// GetConnectionUser 获取连接绑定的用户 ID, 没有绑定时返回 false
+	GetConnectionUser(connection IConnection) (userID string, ok bool)
+	// KickUser 踢出用户的所有连接, 返回踢出的连接数量
+	KickUser(userID string) int
+	// SetDuplicateLoginPolicy 设置重复登录策略: allow, kick, reject
+	SetDuplicateLoginPolicy(policy string)
+	// SetOnKick 设置踢出连接的钩子函数: 在关闭旧连接之前调用, 可以向旧连接发送通知; 调用 KickUser 踢出时 newConnection 为 nil
+	SetOnKick(func(oldConnection IConnection, newConnection IConnection))
 }
@@ -0,0 +1,7 @@
+package ziface
+
+// HandlerFunc 处理请求的函数
+type HandlerFunc func(request IRequest)
+
+// Interceptor 拦截器: 包装下一个处理函数, 可以在处理前后执行公共逻辑或者直接中断处理
+type Interceptor func(next HandlerFunc) HandlerFunc
@@ -0,0 +1,27 @@
+package ziface
+
+// LogLevel 日志级别
+type LogLevel int8
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+	// LogLevelOff 关闭日志
+	LogLevelOff
+)
+
+// ILogger 日志: fields 为交替出现的键值对, 例如 "conn_id", 1, "message_id", 2
+type ILogger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+	// With 返回携带固定字段的日志
+	With(fields ...interface{}) ILogger
+	// Enabled 判断日志级别是否启用, 用于避免构造不会输出的日志
+	Enabled(level LogLevel) bool
+	// SetLevel 修改日志级别, 通过 With 派生的日志同时生效
+	SetLevel(level LogLevel)
+}
@@ -3,9 +3,14 @@ package ziface
 type IMessage interface {
 	GetMessageID() uint32
 	GetMessageLength() uint32
+	// GetMessageData 消息内容: 服务器读取的消息内容来自缓冲池, 只在处理器返回之前有效
+	// 处理器返回之后还需要使用时 (例如交给其他协程), 需要先复制一份
 	GetMessageData() []byte
+	// GetRequestID 请求序列号: 编解码器不支持时为 0
+	GetRequestID() uint32
 
 	SetMessageID(messageID uint32)
 	SetMessageLength(messageLength uint32)
 	SetMessageData(messageData []byte)
+	SetRequestID(requestID uint32)
 }
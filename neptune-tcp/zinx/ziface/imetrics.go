@@ -0,0 +1,41 @@
+package ziface
+
+import "time"
+
+// IMetrics 指标收集器
+type IMetrics interface {
+	// RecordHandle 记录处理器的耗时
+	RecordHandle(messageID uint32, cost time.Duration)
+	// RecordRead 记录读取的消息
+	RecordRead(bytes int)
+	// RecordWrite 记录发送的消息
+	RecordWrite(bytes int)
+	// Snapshot 获取当前指标的快照
+	Snapshot() MetricsSnapshot
+}
+
+// MetricsSnapshot 指标快照
+type MetricsSnapshot struct {
+	// 当前连接数量
+	Connections uint32
+	// 每个消息队列中积压的请求数量
+	TaskQueueDepths []int
+	// 收发的消息数量和字节数
+	MessagesIn  uint64
+	MessagesOut uint64
+	BytesIn     uint64
+	BytesOut    uint64
+	// 消息 ID 对应的处理器指标
+	Handlers map[uint32]HandlerMetrics
+}
+
+// HandlerMetrics 处理器指标
+type HandlerMetrics struct {
+	// 处理次数
+	Count uint64
+	// 总耗时
+	Sum time.Duration
+	// 耗时直方图: Buckets[i] 为耗时不超过 Bounds[i] 的次数 (累计)
+	Bounds  []time.Duration
+	Buckets []uint64
+}
@@ -0,0 +1,24 @@
+package ziface
+
+import "time"
+
+// RateLimitScope 触发限流的范围
+type RateLimitScope string
+
+const (
+	// RateLimitScopeConn 单个连接的限流
+	RateLimitScopeConn RateLimitScope = "conn"
+	// RateLimitScopeMessage 单个连接中指定消息 ID 的限流
+	RateLimitScopeMessage RateLimitScope = "message"
+	// RateLimitScopeServer 服务器所有连接共享的限流
+	RateLimitScopeServer RateLimitScope = "server"
+)
+
+type IRateLimiter interface {
+	// Allow 获取一个令牌, 没有令牌时返回 false 并且不消耗令牌
+	Allow() bool
+	// Reserve 预留一个令牌, 返回令牌可用之前需要等待的时间
+	Reserve() time.Duration
+	// Cancel 归还一个通过 Allow 获取的令牌: 多个范围的限流中后面的范围拒绝时, 前面的范围不消耗令牌
+	Cancel()
+}
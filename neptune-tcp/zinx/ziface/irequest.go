@@ -1,9 +1,17 @@
 package ziface
 
+import "context"
+
 // IRequest 请求
 type IRequest interface {
 	// GetMessage 获取数据
 	GetMessage() IMessage
 	// GetConn 获取连接
 	GetConn() IConnection
+	// GetIdentity 获取连接认证之后的身份, 没有认证时返回 nil
+	GetIdentity() IIdentity
+	// GetRequestID 获取请求序列号, 用于回复对应的请求
+	GetRequestID() uint32
+	// Context 获取请求的上下文: 连接关闭, 服务器停止或者处理超时时取消
+	Context() context.Context
 }
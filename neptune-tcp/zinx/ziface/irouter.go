@@ -1,11 +1,28 @@
 package ziface
 
+import "context"
+
 type IRouter interface {
 	RouterHandler(request IRequest)
 
+	// AddHandler 添加处理器: 消息 ID 的最高两位保留给压缩标志和错误标志, 使用保留位时 panic
 	AddHandler(id uint32, handler IHandler)
 
+	AddInterceptor(interceptors ...Interceptor)
+
+	AddHandlerInterceptor(id uint32, interceptors ...Interceptor)
+
 	StartWorkerPool()
 
+	StopWorkerPool(ctx context.Context) error
+
+	// ResizeWorkerPool 调整工作协程数量: 内联分发时不支持, 返回错误
+	// 哈希分发时等待所有消息队列处理完毕后重建工作协程池, 期间新的请求等待, 同一个连接的请求保持有序
+	ResizeWorkerPool(size uint32) error
+
 	SendMessageToTaskQueue(request IRequest)
+
+	SetLogger(logger ILogger)
+
+	GetTaskQueueDepths() []int
 }
@@ -0,0 +1,11 @@
+package ziface
+
+// ISerializer 序列化器: 类型化路由使用, 负责请求和响应与消息内容之间的转换
+type ISerializer interface {
+	// Name 序列化器名称
+	Name() string
+	// Marshal 序列化
+	Marshal(value interface{}) ([]byte, error)
+	// Unmarshal 反序列化, value 为指针
+	Unmarshal(data []byte, value interface{}) error
+}
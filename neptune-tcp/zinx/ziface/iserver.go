@@ -1,22 +1,71 @@
 package ziface
 
+import (
+	"context"
+	"crypto/tls"
+	"neptune-golang/neptune-tcp/zinx/utils"
+)
+
 type IServer interface {
 	// Start 启动服务器
 	Start()
 	// Serve 运行服务器
 	Serve()
-	// Stop 停止服务器
-	Stop()
-	// AddRouter 添加处理器
+	// Stop 停止服务器: 关闭监听器, 断开所有连接, 在 ctx 截止前等待任务队列中的请求处理完毕
+	Stop(ctx context.Context) error
+	// AddRouter 添加处理器: 消息 ID 的最高两位保留给压缩标志和错误标志, 使用保留位时 panic
 	AddRouter(id uint32, handler IHandler)
+	// AddInterceptor 添加全局拦截器, 按照添加顺序由外到内执行
+	AddInterceptor(interceptors ...Interceptor)
+	// AddRouterInterceptor 添加指定消息 ID 的拦截器, 在全局拦截器之后执行
+	AddRouterInterceptor(id uint32, interceptors ...Interceptor)
+	// GetConfig 获取服务器的配置, 不要修改返回的配置
+	GetConfig() *utils.Configuration
+	// ReloadConfig 重新读取配置文件, 只应用可以在运行时修改的字段
+	ReloadConfig() (ConfigChange, error)
+	// SetOnConfigReload 设置热加载配置的钩子函数
+	SetOnConfigReload(func(change ConfigChange, err error))
 	// GetConnManager 获取连接管理器
 	GetConnManager() IConnManager
+	// SetTLSConfig 设置 TLS 配置, 需要在启动服务器之前设置; 没有设置时使用配置文件中的证书
+	SetTLSConfig(config *tls.Config)
+	// GetMetrics 获取指标收集器
+	GetMetrics() IMetrics
+	// GetMetricsSnapshot 获取当前指标的快照, 包括连接数量和消息队列积压
+	GetMetricsSnapshot() MetricsSnapshot
+	// SetLogger 设置日志, 同时设置路由器和连接管理器的日志
+	SetLogger(logger ILogger)
+	// GetLogger 获取日志
+	GetLogger() ILogger
+	// SetCodec 设置编解码器, 需要在启动服务器之前设置
+	SetCodec(codec ICodec)
+	// GetCodec 获取编解码器
+	GetCodec() ICodec
+	// SetAuthenticator 设置认证器, 需要在启动服务器之前设置; 设置之后连接需要先完成认证, 消息才会交给路由器
+	SetAuthenticator(authenticator IAuthenticator)
+	// GetAuthenticator 获取认证器, 没有设置时返回 nil
+	GetAuthenticator() IAuthenticator
+	// GetRateLimiter 获取服务器所有连接共享的限流器, 没有配置时返回 nil
+	GetRateLimiter() IRateLimiter
 	// GetOnConnStart 获取开始的钩子函数
 	GetOnConnStart(connection IConnection)
 	// GetOnConnStop 获取关闭的钩子函数
 	GetOnConnStop(connection IConnection)
+	// GetOnConnIdle 获取空闲的钩子函数
+	GetOnConnIdle(connection IConnection)
 	// SetOnConnStart 设置开启的钩子函数
 	SetOnConnStart(func(connection IConnection))
-	// SetOnConnStop 设置关闭的钩子函数
+	// SetOnConnStop 设置关闭的钩子函数: 钩子函数中可以获取关闭的原因, 发送的消息在关闭连接之前写入
 	SetOnConnStop(func(connection IConnection))
+	// SetOnConnIdle 设置空闲的钩子函数: 由应用决定关闭连接还是发送心跳探测, 没有设置则直接关闭连接
+	SetOnConnIdle(func(connection IConnection))
+	// GetOnHandlerTimeout 获取处理超时的钩子函数
+	GetOnHandlerTimeout(request IRequest)
+	// SetOnHandlerTimeout 设置处理超时的钩子函数: 在计时协程中调用, 处理器可能仍在运行, 不要读取消息内容
+	// 处理器已经回复时不会执行; 超时之后处理器的回复会被丢弃, 可以通过 znet.ReplyError 回复一次错误; 没有设置则记录日志并回复超时错误
+	SetOnHandlerTimeout(func(request IRequest))
+	// GetOnRateLimited 获取超过限流的钩子函数
+	GetOnRateLimited(connection IConnection, message IMessage, scope RateLimitScope)
+	// SetOnRateLimited 设置超过限流的钩子函数: 在执行限流动作之前调用, 没有设置则记录日志
+	SetOnRateLimited(func(connection IConnection, message IMessage, scope RateLimitScope))
 }
@@ -0,0 +1,170 @@
+package zlog
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// SlogLogger 基于 slog 的日志
+type SlogLogger struct {
+	logger *slog.Logger
+	// 日志级别: 为空时无法修改级别, 由 slog.Handler 决定
+	level *slog.LevelVar
+	// 关闭日志: slog 没有关闭级别, 单独记录
+	off *atomic.Bool
+}
+
+func NewSlogLogger(logger *slog.Logger) ziface.ILogger {
+	return &SlogLogger{logger: logger, off: &atomic.Bool{}}
+}
+
+// NewLogger 根据配置创建日志: level 为 debug/info/warn/error/off, format 为 text/json
+func NewLogger(level string, format string) ziface.ILogger {
+	return NewWriterLogger(os.Stderr, level, format)
+}
+
+func NewWriterLogger(writer io.Writer, level string, format string) ziface.ILogger {
+	levelVar := &slog.LevelVar{}
+	options := &slog.HandlerOptions{Level: levelVar}
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(writer, options)
+	} else {
+		handler = slog.NewTextHandler(writer, options)
+	}
+	logger := &SlogLogger{logger: slog.New(handler), level: levelVar, off: &atomic.Bool{}}
+	logger.SetLevel(ParseLevel(level))
+	return logger
+}
+
+func (logger *SlogLogger) Debug(msg string, fields ...interface{}) {
+	if logger.off.Load() {
+		return
+	}
+	logger.logger.Debug(msg, fields...)
+}
+
+func (logger *SlogLogger) Info(msg string, fields ...interface{}) {
+	if logger.off.Load() {
+		return
+	}
+	logger.logger.Info(msg, fields...)
+}
+
+func (logger *SlogLogger) Warn(msg string, fields ...interface{}) {
+	if logger.off.Load() {
+		return
+	}
+	logger.logger.Warn(msg, fields...)
+}
+
+func (logger *SlogLogger) Error(msg string, fields ...interface{}) {
+	if logger.off.Load() {
+		return
+	}
+	logger.logger.Error(msg, fields...)
+}
+
+func (logger *SlogLogger) With(fields ...interface{}) ziface.ILogger {
+	return &SlogLogger{logger: logger.logger.With(fields...), level: logger.level, off: logger.off}
+}
+
+func (logger *SlogLogger) Enabled(level ziface.LogLevel) bool {
+	if level >= ziface.LogLevelOff || logger.off.Load() {
+		return false
+	}
+	return logger.logger.Enabled(context.Background(), toSlogLevel(level))
+}
+
+func (logger *SlogLogger) SetLevel(level ziface.LogLevel) {
+	logger.off.Store(level >= ziface.LogLevelOff)
+	if logger.level != nil && level < ziface.LogLevelOff {
+		logger.level.Set(toSlogLevel(level))
+	}
+}
+
+// NopLogger 不输出任何日志, 用于基准测试
+type NopLogger struct {
+}
+
+func NewNopLogger() ziface.ILogger {
+	return &NopLogger{}
+}
+
+func (logger *NopLogger) Debug(msg string, fields ...interface{}) {
+}
+
+func (logger *NopLogger) Info(msg string, fields ...interface{}) {
+}
+
+func (logger *NopLogger) Warn(msg string, fields ...interface{}) {
+}
+
+func (logger *NopLogger) Error(msg string, fields ...interface{}) {
+}
+
+func (logger *NopLogger) With(fields ...interface{}) ziface.ILogger {
+	return logger
+}
+
+func (logger *NopLogger) Enabled(level ziface.LogLevel) bool {
+	return false
+}
+
+func (logger *NopLogger) SetLevel(level ziface.LogLevel) {
+}
+
+// ParseLevel 解析日志级别, 无法识别时使用 info
+func ParseLevel(level string) ziface.LogLevel {
+	switch strings.ToLower(level) {
+	case "debug":
+		return ziface.LogLevelDebug
+	case "warn", "warning":
+		return ziface.LogLevelWarn
+	case "error":
+		return ziface.LogLevelError
+	case "off", "none":
+		return ziface.LogLevelOff
+	default:
+		return ziface.LogLevelInfo
+	}
+}
+
+func toSlogLevel(level ziface.LogLevel) slog.Level {
+	switch level {
+	case ziface.LogLevelDebug:
+		return slog.LevelDebug
+	case ziface.LogLevelWarn:
+		return slog.LevelWarn
+	case ziface.LogLevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// 默认日志: 没有绑定服务器的组件使用
+var defaultLogger atomic.Value
+
+func init() {
+	defaultLogger.Store(&loggerHolder{logger: NewLogger("info", "text")})
+}
+
+type loggerHolder struct {
+	logger ziface.ILogger
+}
+
+// Default 获取默认日志
+func Default() ziface.ILogger {
+	return defaultLogger.Load().(*loggerHolder).logger
+}
+
+// SetDefault 设置默认日志
+func SetDefault(logger ziface.ILogger) {
+	defaultLogger.Store(&loggerHolder{logger: logger})
+}
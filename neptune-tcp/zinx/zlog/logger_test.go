@@ -0,0 +1,72 @@
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"strings"
+	"testing"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewWriterLogger(&buf, "warn", "text")
+	// 1. 低于级别的日志不输出
+	logger.Debug("debug message")
+	logger.Info("info message")
+	logger.Warn("warn message")
+	logger.Error("error message")
+	output := buf.String()
+	if strings.Contains(output, "debug message") || strings.Contains(output, "info message") {
+		t.Fatalf("output below level: %s", output)
+	}
+	if !strings.Contains(output, "warn message") || !strings.Contains(output, "error message") {
+		t.Fatalf("output missing: %s", output)
+	}
+	if logger.Enabled(ziface.LogLevelInfo) || !logger.Enabled(ziface.LogLevelWarn) {
+		t.Fatal("enabled doesn't match level")
+	}
+	// 2. 修改级别同时影响派生的日志
+	child := logger.With("conn_id", 1)
+	logger.SetLevel(ziface.LogLevelDebug)
+	buf.Reset()
+	child.Debug("child debug")
+	if !strings.Contains(buf.String(), "child debug") || !strings.Contains(buf.String(), "conn_id=1") {
+		t.Fatalf("child output: %s", buf.String())
+	}
+	// 3. 关闭日志
+	logger.SetLevel(ziface.LogLevelOff)
+	buf.Reset()
+	child.Error("off message")
+	if buf.Len() != 0 || child.Enabled(ziface.LogLevelError) {
+		t.Fatalf("output after off: %s", buf.String())
+	}
+}
+
+func TestLoggerJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewWriterLogger(&buf, "info", "json")
+	logger.Info("[zinx] message", "message_id", 7)
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("output not json: %s", buf.String())
+	}
+	if record["msg"] != "[zinx] message" || record["level"] != "INFO" || record["message_id"] != float64(7) {
+		t.Fatalf("record = %v", record)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for level, want := range map[string]ziface.LogLevel{
+		"debug":   ziface.LogLevelDebug,
+		"INFO":    ziface.LogLevelInfo,
+		"warning": ziface.LogLevelWarn,
+		"error":   ziface.LogLevelError,
+		"off":     ziface.LogLevelOff,
+		"unknown": ziface.LogLevelInfo,
+	} {
+		if got := ParseLevel(level); got != want {
+			t.Fatalf("ParseLevel(%q) = %d, want %d", level, got, want)
+		}
+	}
+}
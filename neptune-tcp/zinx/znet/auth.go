@@ -0,0 +1,100 @@
+package znet
+
+import (
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrAuthTimeout      = errors.New("[zinx] authenticate timeout")
+	ErrAuthTooManyTries = errors.New("[zinx] authenticate too many messages")
+)
+
+// AuthenticatorFunc 使用函数实现认证器
+type AuthenticatorFunc func(connection ziface.IConnection, message ziface.IMessage) (ziface.IIdentity, error)
+
+func (fn AuthenticatorFunc) Authenticate(connection ziface.IConnection, message ziface.IMessage) (ziface.IIdentity, error) {
+	return fn(connection, message)
+}
+
+// IdentityOf 获取连接的身份并转换为应用定义的类型: 没有认证或者类型不匹配时返回 false
+func IdentityOf[T ziface.IIdentity](connection ziface.IConnection) (T, bool) {
+	identity, ok := connection.GetIdentity().(T)
+	return identity, ok
+}
+
+// identity 连接认证之后的身份: 读协程设置, 处理器和其他协程读取
+type identity struct {
+	value atomic.Pointer[identityValue]
+}
+
+type identityValue struct {
+	identity ziface.IIdentity
+}
+
+func (identity *identity) get() ziface.IIdentity {
+	if value := identity.value.Load(); value != nil {
+		return value.identity
+	}
+	return nil
+}
+
+func (identity *identity) set(value ziface.IIdentity) {
+	identity.value.Store(&identityValue{identity: value})
+}
+
+// startAuth 开始认证阶段: 超过时间没有完成认证则关闭连接, 创建连接时调用
+func (conn *Connection) startAuth(config *utils.Configuration) {
+	if conn.authenticator == nil || config.ZinxAuthTimeout == 0 {
+		return
+	}
+	conn.authTimer = time.AfterFunc(time.Duration(config.ZinxAuthTimeout)*time.Second, func() {
+		if conn.GetIdentity() != nil {
+			return
+		}
+		conn.Logger.Warn("[zinx] authenticate failed", "err", ErrAuthTimeout)
+		conn.StopConnWithReason(ErrAuthTimeout)
+	})
+}
+
+// stopAuth 结束认证阶段: 认证通过或者连接关闭时停止计时
+func (conn *Connection) stopAuth() {
+	if conn.authTimer != nil {
+		conn.authTimer.Stop()
+	}
+}
+
+// authenticate 认证阶段的消息交给认证器处理, 返回消息是否已经被认证器处理
+// 认证失败或者超过消息数量仍未完成认证时关闭连接
+func (conn *Connection) authenticate(config *utils.Configuration, message ziface.IMessage) bool {
+	if conn.authenticator == nil || conn.GetIdentity() != nil {
+		return false
+	}
+	// 1. 交给认证器处理
+	conn.authMessages++
+	identity, err := conn.authenticator.Authenticate(conn, message)
+	switch {
+	// 2. 认证失败
+	case err != nil:
+		conn.Logger.Warn("[zinx] authenticate failed", "message_id", message.GetMessageID(), "err", err)
+		conn.stopAsync(err)
+	// 3. 认证通过: 绑定身份的 ID, 之后的消息交给路由器; 同一个用户已经登录时按照重复登录策略处理
+	case identity != nil:
+		if err := conn.Server.GetConnManager().BindUser(identity.GetID(), conn); err != nil {
+			conn.Logger.Warn("[zinx] authenticate failed", "identity", identity.GetID(), "err", err)
+			conn.stopAsync(err)
+			break
+		}
+		conn.identity.set(identity)
+		conn.stopAuth()
+		conn.Logger.Info("[zinx] conn authenticated", "identity", identity.GetID())
+	// 4. 需要继续认证, 但是已经超过消息数量
+	case conn.authMessages >= config.ZinxAuthMaxMessages:
+		conn.Logger.Warn("[zinx] authenticate failed", "messages", conn.authMessages, "err", ErrAuthTooManyTries)
+		conn.stopAsync(ErrAuthTooManyTries)
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package znet
+
+import (
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"testing"
+	"time"
+)
+
+var errBadToken = errors.New("bad token")
+
+// testIdentity 测试使用的身份
+type testIdentity struct {
+	id string
+}
+
+func (identity *testIdentity) GetID() string {
+	return identity.id
+}
+
+// tokenAuthenticator 消息内容为 token 时认证通过, 为 bad 时认证失败, 其他内容需要继续认证
+var tokenAuthenticator = AuthenticatorFunc(func(connection ziface.IConnection, message ziface.IMessage) (ziface.IIdentity, error) {
+	switch string(message.GetMessageData()) {
+	case "token":
+		return &testIdentity{id: "user-1"}, nil
+	case "bad":
+		return nil, errBadToken
+	}
+	return nil, nil
+})
+
+// newAuthServer 创建设置了认证器的服务器
+func newAuthServer(t *testing.T, timeout uint32, maxMessages uint32) *Server {
+	t.Helper()
+	config := utils.NewConfiguration()
+	config.ZinxAuthTimeout = timeout
+	config.ZinxAuthMaxMessages = maxMessages
+	return newTestServer(t, WithConfig(config), WithAuthenticator(tokenAuthenticator))
+}
+
+func TestAuthTimeout(t *testing.T) {
+	t.Parallel()
+	server := newAuthServer(t, 1, 3)
+	conn, _ := newTestConn(server, 1)
+	conn.StartConn()
+	// 超过时间没有完成认证: 关闭连接
+	select {
+	case <-conn.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("unauthenticated conn not closed")
+	}
+	if !errors.Is(conn.GetCloseReason(), ErrAuthTimeout) {
+		t.Fatalf("reason = %v", conn.GetCloseReason())
+	}
+}
+
+func TestAuthFailed(t *testing.T) {
+	server := newAuthServer(t, 10, 3)
+	conn, peer := newTestConn(server, 1)
+	conn.StartConn()
+	// 认证器返回错误: 关闭连接, 关闭原因是认证器的错误
+	writeFrame(t, peer, 1, []byte("bad"))
+	waitDone(t, conn)
+	if !errors.Is(conn.GetCloseReason(), errBadToken) {
+		t.Fatalf("reason = %v", conn.GetCloseReason())
+	}
+	if conn.GetIdentity() != nil {
+		t.Fatalf("identity = %v", conn.GetIdentity())
+	}
+}
+
+func TestAuthTooManyMessages(t *testing.T) {
+	server := newAuthServer(t, 10, 3)
+	handled := make(chan struct{}, 3)
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		handled <- struct{}{}
+	}})
+	startWorkers(t, server)
+	conn, peer := newTestConn(server, 1)
+	conn.StartConn()
+	// 超过消息数量仍未完成认证: 关闭连接, 认证阶段的消息不交给路由器
+	for i := 0; i < 3; i++ {
+		writeFrame(t, peer, 1, []byte("challenge"))
+	}
+	waitDone(t, conn)
+	if !errors.Is(conn.GetCloseReason(), ErrAuthTooManyTries) {
+		t.Fatalf("reason = %v", conn.GetCloseReason())
+	}
+	if len(handled) != 0 {
+		t.Fatalf("handled %d messages before authenticated", len(handled))
+	}
+}
+
+func TestAuthIdentity(t *testing.T) {
+	server := newAuthServer(t, 10, 3)
+	identities := make(chan ziface.IIdentity, 1)
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		identity, ok := IdentityOf[*testIdentity](request.GetConn())
+		if !ok || request.GetIdentity() != identity {
+			identities <- nil
+			return
+		}
+		identities <- request.GetIdentity()
+	}})
+	startWorkers(t, server)
+	conn, peer := newTestConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	// 1. 挑战应答: 第一条消息需要继续认证, 第二条消息认证通过
+	writeFrame(t, peer, 1, []byte("challenge"))
+	writeFrame(t, peer, 1, []byte("token"))
+	// 2. 认证通过之后的消息交给路由器, 请求可以获取身份
+	writeFrame(t, peer, 1, []byte("hello"))
+	select {
+	case identity := <-identities:
+		if identity == nil || identity.GetID() != "user-1" {
+			t.Fatalf("identity = %v", identity)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request not handled")
+	}
+	if users := server.GetConnManager().GetUserConnections("user-1"); len(users) != 1 {
+		t.Fatalf("user connections = %d", len(users))
+	}
+}
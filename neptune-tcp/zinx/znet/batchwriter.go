@@ -0,0 +1,54 @@
+package znet
+
+import "net"
+
+// batchWriter 一次写入多条消息: 支持 writev 的 TCP 连接直接使用 net.Buffers,
+// 其他连接 (例如 TLS) 先合并到一个缓冲区, 避免每条消息单独产生一个 TLS 记录和系统调用
+type batchWriter struct {
+	conn     net.Conn
+	vectored bool
+	// net.Buffers 写入时会修改切片, 每次写入前从批量消息复制
+	buffers net.Buffers
+	// 复用的批量消息切片
+	batch []*Buffer
+}
+
+func newBatchWriter(conn net.Conn, batchSize int) *batchWriter {
+	_, vectored := conn.(*net.TCPConn)
+	return &batchWriter{
+		conn:     conn,
+		vectored: vectored,
+		buffers:  make(net.Buffers, 0, batchSize),
+		batch:    make([]*Buffer, 0, batchSize),
+	}
+}
+
+func (writer *batchWriter) write(batch []*Buffer) error {
+	// 1. 只有一条消息时直接写入
+	if len(batch) == 1 {
+		_, err := writer.conn.Write(batch[0].B)
+		return err
+	}
+	// 2. TCP 连接使用 writev
+	if writer.vectored {
+		writer.buffers = writer.buffers[:0]
+		for _, buffer := range batch {
+			writer.buffers = append(writer.buffers, buffer.B)
+		}
+		_, err := writer.buffers.WriteTo(writer.conn)
+		return err
+	}
+	// 3. 其他连接合并到一个缓冲区后写入
+	size := 0
+	for _, buffer := range batch {
+		size += len(buffer.B)
+	}
+	merged := GetBuffer(size)
+	buf := merged.B[:0]
+	for _, buffer := range batch {
+		buf = append(buf, buffer.B...)
+	}
+	_, err := writer.conn.Write(buf)
+	PutBuffer(merged)
+	return err
+}
@@ -0,0 +1,101 @@
+package znet
+
+import (
+	"fmt"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// countingConn 记录写入的次数
+type countingConn struct {
+	net.Conn
+	writes atomic.Int32
+}
+
+func (conn *countingConn) Write(buf []byte) (int, error) {
+	conn.writes.Add(1)
+	return conn.Conn.Write(buf)
+}
+
+// newBatchConn 创建写入批量大小为 batchSize 的连接, 启动前先在发送队列中放入 count 条消息
+func newBatchConn(t *testing.T, batchSize uint32, count int) (*Connection, *countingConn, net.Conn) {
+	t.Helper()
+	config := utils.NewConfiguration()
+	config.ZinxWriteBatchSize = batchSize
+	server := newTestServer(t, WithConfig(config))
+	local, peer := net.Pipe()
+	counting := &countingConn{Conn: local}
+	conn := NewConn(1, counting, server.Router, server)
+	t.Cleanup(conn.StopConn)
+	for i := 0; i < count; i++ {
+		if err := conn.SendMessage(1, []byte(fmt.Sprintf("frame-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conn, counting, peer
+}
+
+func readFrames(t *testing.T, peer net.Conn, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if _, data := readFrame(t, peer); string(data) != fmt.Sprintf("frame-%d", i) {
+			t.Fatalf("frame %d = %q", i, data)
+		}
+	}
+}
+
+func TestWriteBatchCoalesces(t *testing.T) {
+	// 发送队列中的消息合并为一次写入
+	conn, counting, peer := newBatchConn(t, 32, 8)
+	conn.StartConn()
+	readFrames(t, peer, 8)
+	if writes := counting.writes.Load(); writes != 1 {
+		t.Fatalf("writes = %d, want 1", writes)
+	}
+}
+
+func TestWriteBatchSize(t *testing.T) {
+	// 每次最多合并批量大小的消息
+	conn, counting, peer := newBatchConn(t, 3, 8)
+	conn.StartConn()
+	readFrames(t, peer, 8)
+	if writes := counting.writes.Load(); writes != 3 {
+		t.Fatalf("writes = %d, want 3", writes)
+	}
+}
+
+func TestWriteBatchVectored(t *testing.T) {
+	// TCP 连接使用 writev 写入, 消息保持顺序
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := listener.Accept()
+		accepted <- conn
+	}()
+	local, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := <-accepted
+	defer peer.Close()
+	writer := newBatchWriter(local, 8)
+	if !writer.vectored {
+		t.Fatal("tcp conn not vectored")
+	}
+	batch := make([]*Buffer, 0, 8)
+	for i := 0; i < 8; i++ {
+		buf, _ := encodeBuffer(NewCodec(), NewMessage(1, []byte(fmt.Sprintf("frame-%d", i))))
+		batch = append(batch, buf)
+	}
+	if err := writer.write(batch); err != nil {
+		t.Fatal(err)
+	}
+	readFrames(t, peer, 8)
+	_ = local.Close()
+}
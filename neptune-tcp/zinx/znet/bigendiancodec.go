@@ -0,0 +1,77 @@
+package znet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+)
+
+const (
+	// BigEndianCodecMagic 魔数: 用于快速识别非法的数据流
+	BigEndianCodecMagic uint8 = 0x5A
+	// BigEndianCodecVersion 协议版本
+	BigEndianCodecVersion uint8 = 0x01
+)
+
+// BigEndianCodec 大端序编解码器: 魔数 1B + 版本 1B + 序列号 4B + 消息长度 4B
+type BigEndianCodec struct {
+	Magic   uint8
+	Version uint8
+}
+
+func NewBigEndianCodec() ziface.ICodec {
+	return &BigEndianCodec{
+		Magic:   BigEndianCodecMagic,
+		Version: BigEndianCodecVersion,
+	}
+}
+
+func (codec *BigEndianCodec) GetHeadLength() uint32 {
+	// 魔数 1B + 版本 1B + 序列号 4B + 消息长度 4B
+	return 10
+}
+
+func (codec *BigEndianCodec) Encode(message ziface.IMessage) (data []byte, err error) {
+	buffer, err := codec.EncodeBuffer(message)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.B, nil
+}
+
+func (codec *BigEndianCodec) EncodeBuffer(message ziface.IMessage) (*Buffer, error) {
+	// 1. 从缓冲池获取缓冲区
+	buffer := GetBuffer(int(codec.GetHeadLength() + message.GetMessageLength()))
+	buf := buffer.B
+	// 2. 写入魔数和版本
+	buf[0] = codec.Magic
+	buf[1] = codec.Version
+	// 3. 写入序列号
+	binary.BigEndian.PutUint32(buf[2:6], message.GetMessageID())
+	// 4. 写入消息长度
+	binary.BigEndian.PutUint32(buf[6:10], message.GetMessageLength())
+	// 5. 写入消息内容
+	copy(buf[10:], message.GetMessageData())
+	return buffer, nil
+}
+
+func (codec *BigEndianCodec) Decode(data []byte) (message ziface.IMessage, err error) {
+	// 1. 检查头部长度
+	if uint32(len(data)) < codec.GetHeadLength() {
+		return nil, errors.New("[zinx] receive head buf too short")
+	}
+	// 2. 校验魔数和版本
+	if data[0] != codec.Magic {
+		return nil, fmt.Errorf("[zinx] receive unknown magic %#x", data[0])
+	}
+	if data[1] != codec.Version {
+		return nil, fmt.Errorf("[zinx] receive unsupported version %d", data[1])
+	}
+	// 3. 读取消息序列号和长度
+	response := &Message{
+		MessageID:     binary.BigEndian.Uint32(data[2:6]),
+		MessageLength: binary.BigEndian.Uint32(data[6:10]),
+	}
+	return response, nil
+}
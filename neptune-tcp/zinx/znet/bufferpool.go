@@ -0,0 +1,109 @@
+package znet
+
+import (
+	"math/bits"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"sync"
+)
+
+// 缓冲池按照 2 的幂划分大小等级: 64B, 128B, ..., 64KB; 超过最大等级的缓冲区直接分配, 不放回缓冲池
+const (
+	minBufferShift = 6
+	maxBufferShift = 16
+)
+
+// 读取消息时 bufio 的缓冲区大小
+const readBufferSize = 4096
+
+var bufferPools [maxBufferShift - minBufferShift + 1]sync.Pool
+
+// Buffer 缓冲区: 只有 GetBuffer 获取的缓冲区才会被 PutBuffer 放回缓冲池
+type Buffer struct {
+	B []byte
+	// 是否属于缓冲池: 放回之后清除, 重复放回时直接丢弃
+	pooled bool
+}
+
+// NewBuffer 包装调用方的缓冲区, PutBuffer 不会把它放回缓冲池
+func NewBuffer(buf []byte) *Buffer {
+	return &Buffer{B: buf}
+}
+
+// GetBuffer 从缓冲池获取长度为 size 的缓冲区, 缓冲区的内容没有清零
+func GetBuffer(size int) *Buffer {
+	class := bufferClass(size)
+	if class < 0 {
+		return &Buffer{B: make([]byte, size)}
+	}
+	if buffer, ok := bufferPools[class].Get().(*Buffer); ok {
+		buffer.B = buffer.B[:size]
+		buffer.pooled = true
+		return buffer
+	}
+	return &Buffer{B: make([]byte, size, 1<<(class+minBufferShift)), pooled: true}
+}
+
+// PutBuffer 把 GetBuffer 获取的缓冲区放回缓冲池, 放回之后调用方不能再使用缓冲区
+// NewBuffer 包装的缓冲区, 超过最大等级的缓冲区以及已经放回的缓冲区直接丢弃
+func PutBuffer(buffer *Buffer) {
+	if buffer == nil || !buffer.pooled {
+		return
+	}
+	buffer.pooled = false
+	// 调用方追加内容导致重新分配时, 容量可能不再是等级大小
+	class := bufferClass(cap(buffer.B))
+	if class < 0 || cap(buffer.B) != 1<<(class+minBufferShift) {
+		return
+	}
+	buffer.B = buffer.B[:0]
+	bufferPools[class].Put(buffer)
+}
+
+// BufferEncoder 把消息编码到缓冲池的缓冲区: 连接写入之后放回缓冲池, 内置的编解码器都实现了这个接口
+// 只实现 ziface.ICodec 的编解码器, Encode 返回的缓冲区写入之后直接丢弃
+type BufferEncoder interface {
+	EncodeBuffer(message ziface.IMessage) (*Buffer, error)
+}
+
+// encodeBuffer 编解码器实现了 BufferEncoder 时使用缓冲池, 否则包装 Encode 返回的缓冲区
+func encodeBuffer(codec ziface.ICodec, message ziface.IMessage) (*Buffer, error) {
+	if encoder, ok := codec.(BufferEncoder); ok {
+		return encoder.EncodeBuffer(message)
+	}
+	buf, err := codec.Encode(message)
+	if err != nil {
+		return nil, err
+	}
+	return NewBuffer(buf), nil
+}
+
+// bufferClass 返回能够容纳 size 字节的最小等级, 超过最大等级时返回 -1
+func bufferClass(size int) int {
+	if size <= 1<<minBufferShift {
+		return 0
+	}
+	shift := bits.Len(uint(size - 1))
+	if shift > maxBufferShift {
+		return -1
+	}
+	return shift - minBufferShift
+}
+
+// attachBuffer 使用缓冲池中的缓冲区作为消息内容, 处理完毕后由 releaseMessage 放回缓冲池
+func attachBuffer(message ziface.IMessage, buffer *Buffer) {
+	message.SetMessageData(buffer.B)
+	if pooled, ok := message.(*Message); ok {
+		pooled.buffer = buffer
+	}
+}
+
+// releaseMessage 把消息内容放回缓冲池, 之后不能再读取消息内容
+func releaseMessage(message ziface.IMessage) {
+	pooled, ok := message.(*Message)
+	if !ok || pooled.buffer == nil {
+		return
+	}
+	PutBuffer(pooled.buffer)
+	pooled.buffer = nil
+	pooled.MessageData = nil
+}
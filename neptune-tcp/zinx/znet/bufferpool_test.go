@@ -0,0 +1,191 @@
+package znet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"testing"
+)
+
+var benchmarkData = bytes.Repeat([]byte("z"), 512)
+
+// encodeWithBinaryWrite 使用缓冲池之前的编码方式: 每条消息创建新的 bytes.Buffer, 通过反射写入
+func encodeWithBinaryWrite(message ziface.IMessage) []byte {
+	buf := bytes.NewBuffer([]byte{})
+	_ = binary.Write(buf, binary.LittleEndian, message.GetMessageID())
+	_ = binary.Write(buf, binary.LittleEndian, message.GetMessageLength())
+	_ = binary.Write(buf, binary.LittleEndian, message.GetMessageData())
+	return buf.Bytes()
+}
+
+// readWithAllocation 使用缓冲池之前的读取方式: 每条消息分配头部和消息体
+func readWithAllocation(reader io.Reader, codec ziface.ICodec) (ziface.IMessage, error) {
+	headBuf := make([]byte, codec.GetHeadLength())
+	if _, err := io.ReadFull(reader, headBuf); err != nil {
+		return nil, err
+	}
+	message, err := codec.Decode(headBuf)
+	if err != nil {
+		return nil, err
+	}
+	dataBuf := make([]byte, message.GetMessageLength())
+	if _, err := io.ReadFull(reader, dataBuf); err != nil {
+		return nil, err
+	}
+	message.SetMessageData(dataBuf)
+	return message, nil
+}
+
+// repeatReader 循环输出同一段数据, 模拟连接上连续到达的消息
+type repeatReader struct {
+	data   []byte
+	offset int
+}
+
+func (reader *repeatReader) Read(buf []byte) (int, error) {
+	n := copy(buf, reader.data[reader.offset:])
+	reader.offset = (reader.offset + n) % len(reader.data)
+	return n, nil
+}
+
+func TestBufferPool(t *testing.T) {
+	for _, size := range []int{0, 1, 64, 65, 4096, 5000, 1 << maxBufferShift} {
+		buf := GetBuffer(size)
+		if len(buf.B) != size {
+			t.Fatalf("GetBuffer(%d) len = %d", size, len(buf.B))
+		}
+		if cap(buf.B) < size || cap(buf.B)&(cap(buf.B)-1) != 0 {
+			t.Fatalf("GetBuffer(%d) cap = %d", size, cap(buf.B))
+		}
+		PutBuffer(buf)
+	}
+	// 超过最大等级的缓冲区直接分配
+	if buf := GetBuffer(1<<maxBufferShift + 1); len(buf.B) != 1<<maxBufferShift+1 {
+		t.Fatalf("GetBuffer len = %d", len(buf.B))
+	}
+}
+
+func TestPutBufferOwnership(t *testing.T) {
+	// 1. 调用方的缓冲区容量恰好等于等级大小, 同样不会放回缓冲池
+	owned := make([]byte, 1024)
+	PutBuffer(NewBuffer(owned))
+	for i := 0; i < 16; i++ {
+		if buf := GetBuffer(1024); &buf.B[0] == &owned[0] {
+			t.Fatal("caller buffer reused by pool")
+		}
+	}
+	// 2. 重复放回同一个缓冲区只放回一次
+	buf := GetBuffer(1024)
+	PutBuffer(buf)
+	PutBuffer(buf)
+	if buf.pooled {
+		t.Fatal("buffer still pooled after put")
+	}
+}
+
+func TestBufferClass(t *testing.T) {
+	for size, want := range map[int]int{
+		0:                     0,
+		64:                    0,
+		65:                    1,
+		128:                   1,
+		4096:                  6,
+		4097:                  7,
+		1 << maxBufferShift:   maxBufferShift - minBufferShift,
+		1<<maxBufferShift + 1: -1,
+	} {
+		if class := bufferClass(size); class != want {
+			t.Fatalf("bufferClass(%d) = %d, want %d", size, class, want)
+		}
+	}
+}
+
+func TestReleaseMessage(t *testing.T) {
+	message := NewMessage(1, nil)
+	attachBuffer(message, GetBuffer(len(benchmarkData)))
+	releaseMessage(message)
+	if message.GetMessageData() != nil {
+		t.Fatal("message data should be nil after release")
+	}
+	// 重复释放不会把缓冲区放回两次
+	releaseMessage(message)
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []ziface.ICodec{NewCodec(), NewBigEndianCodec(), NewSequenceCodec()} {
+		message := NewMessage(7, benchmarkData)
+		buf, err := codec.Encode(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Encode 返回的缓冲区归调用方所有, 不会放回缓冲池
+		decoded, err := codec.Decode(buf[:codec.GetHeadLength()])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.GetMessageID() != 7 || decoded.GetMessageLength() != uint32(len(benchmarkData)) {
+			t.Fatalf("%T decode message id %d length %d", codec, decoded.GetMessageID(), decoded.GetMessageLength())
+		}
+		if !bytes.Equal(buf[codec.GetHeadLength():], benchmarkData) {
+			t.Fatalf("%T encode body mismatch", codec)
+		}
+	}
+}
+
+func BenchmarkEncodeBinaryWrite(b *testing.B) {
+	message := NewMessage(1, benchmarkData)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		encodeWithBinaryWrite(message)
+	}
+}
+
+func BenchmarkEncodePooled(b *testing.B) {
+	codec := NewCodec()
+	message := NewMessage(1, benchmarkData)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ := encodeBuffer(codec, message)
+		PutBuffer(buf)
+	}
+}
+
+func BenchmarkReadAllocated(b *testing.B) {
+	codec := NewCodec()
+	frame := encodeWithBinaryWrite(NewMessage(1, benchmarkData))
+	reader := &repeatReader{data: frame}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(frame)))
+	for i := 0; i < b.N; i++ {
+		if _, err := readWithAllocation(reader, codec); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadPooled(b *testing.B) {
+	codec := NewCodec()
+	frame := encodeWithBinaryWrite(NewMessage(1, benchmarkData))
+	// 与 ReadConn 相同: bufio 读取, 头部缓冲区复用, 消息体来自缓冲池
+	reader := bufio.NewReaderSize(&repeatReader{data: frame}, readBufferSize)
+	headBuf := make([]byte, codec.GetHeadLength())
+	b.ReportAllocs()
+	b.SetBytes(int64(len(frame)))
+	for i := 0; i < b.N; i++ {
+		if _, err := io.ReadFull(reader, headBuf); err != nil {
+			b.Fatal(err)
+		}
+		message, err := codec.Decode(headBuf)
+		if err != nil {
+			b.Fatal(err)
+		}
+		dataBuf := GetBuffer(int(message.GetMessageLength()))
+		if _, err := io.ReadFull(reader, dataBuf.B); err != nil {
+			b.Fatal(err)
+		}
+		attachBuffer(message, dataBuf)
+		releaseMessage(message)
+	}
+}
@@ -0,0 +1,664 @@
+package znet
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrClientClosed       = errors.New("[zinx] client already closed")
+	ErrClientDisconnected = errors.New("[zinx] client not connected")
+	ErrCallTimeout        = errors.New("[zinx] client call timeout")
+)
+
+// 客户端默认的消息最大长度, 和服务器的默认配置保持一致
+var defaultClientMaxPackage = utils.NewConfiguration().ZinxMaxPackage
+
+const (
+	// 默认的重连退避时间
+	defaultMinReconnectDelay = 100 * time.Millisecond
+	defaultMaxReconnectDelay = 10 * time.Second
+	// 等待处理器处理的消息数量: 超过之后读协程阻塞
+	clientHandlerQueueSize = 1024
+)
+
+// clientCall 等待响应的调用
+type clientCall struct {
+	requestID uint32
+	wait      chan ziface.IMessage
+}
+
+// Client 客户端: 实现 IConnection, 处理器可以直接通过请求回复服务器
+type Client struct {
+	// 服务器地址
+	Network string
+	Address string
+	// 编解码器: 需要和服务器保持一致
+	Codec ziface.ICodec
+	// TLS 配置: 为空时不启用 TLS
+	TLSConfig *tls.Config
+	// 处理器集合
+	Apis map[uint32]ziface.IHandler
+	// 是否自动重连
+	Reconnect bool
+	// 重连退避时间: 每次失败后翻倍, 不超过最大值
+	MinReconnectDelay time.Duration
+	MaxReconnectDelay time.Duration
+	// 心跳消息 ID: 需要和服务器保持一致, 0 表示不启用
+	HeartbeatID uint32
+	// 心跳探测间隔: 0 表示只回复服务器的探测, 不主动发送
+	HeartbeatInterval time.Duration
+	// 压缩: 连接后通过协商消息 ID 发送支持的算法列表 (逗号分隔), 服务器选中后双方开始压缩
+	// 协商消息 ID 为 0 时直接使用 Compression 指定的算法, 需要和服务器保持一致; 为空表示不压缩
+	Compression          string
+	CompressionID        uint32
+	CompressionThreshold uint32
+	// 消息的最大长度: 同时限制解压后的长度, 避免压缩炸弹; 0 表示使用默认值
+	MaxPackage uint32
+	// 日志
+	Logger ziface.ILogger
+	// 钩子函数
+	OnConnStart func(connection ziface.IConnection)
+	OnConnStop  func(connection ziface.IConnection)
+	// 连接
+	conn     net.Conn
+	connLock sync.RWMutex
+	// 写锁: 保证消息完整写入
+	writeLock sync.Mutex
+	// 等待响应的调用: 按照消息 ID 分组
+	pending     map[uint32][]*clientCall
+	pendingLock sync.Mutex
+	// 请求序列号生成器
+	requestID uint32
+	// 关闭的通知管道和上下文
+	exitChan chan struct{}
+	exitOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	// 读协程是否在运行: 读协程负责断线重连, 保证同时只有一个
+	running atomic.Bool
+	// 保证只启动一个心跳协程
+	heartbeatOnce sync.Once
+	// 等待处理器处理的请求: 处理器在单独的协程中按顺序执行, 读协程可以继续读取响应
+	handlerQueue chan clientTask
+	handlerOnce  sync.Once
+	// 附加参数
+	properties   map[string]interface{}
+	propertyLock sync.RWMutex
+	// 协商的压缩算法
+	compression compression
+}
+
+func NewClient(ip string, port uint32) *Client {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &Client{
+		Network:              "tcp",
+		Address:              fmt.Sprintf("%s:%d", ip, port),
+		Codec:                NewCodec(),
+		Apis:                 make(map[uint32]ziface.IHandler),
+		Logger:               zlog.Default(),
+		Reconnect:            true,
+		MinReconnectDelay:    defaultMinReconnectDelay,
+		MaxReconnectDelay:    defaultMaxReconnectDelay,
+		CompressionThreshold: 1024,
+		MaxPackage:           defaultClientMaxPackage,
+		pending:              make(map[uint32][]*clientCall),
+		handlerQueue:         make(chan clientTask, clientHandlerQueueSize),
+		exitChan:             make(chan struct{}),
+		ctx:                  ctx,
+		cancel:               cancel,
+		properties:           make(map[string]interface{}),
+	}
+}
+
+func (client *Client) Dial() error {
+	// 1. 检查客户端是否已经关闭
+	if client.isClosed() {
+		return ErrClientClosed
+	}
+	// 2. 读协程已经在运行: 已经连接或者正在重连
+	if !client.running.CompareAndSwap(false, true) {
+		return nil
+	}
+	// 3. 建立连接
+	if err := client.connect(); err != nil {
+		client.running.Store(false)
+		return err
+	}
+	// 4. 启动读协程和处理器协程
+	go client.ReadConn()
+	client.handlerOnce.Do(func() {
+		go client.handleRequests()
+	})
+	// 5. 启动心跳协程
+	if client.HeartbeatID != 0 && client.HeartbeatInterval > 0 {
+		client.heartbeatOnce.Do(func() {
+			go client.heartbeat()
+		})
+	}
+	return nil
+}
+
+func (client *Client) heartbeat() {
+	ticker := time.NewTicker(client.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// 断线重连期间发送失败, 直接忽略
+			if err := client.SendHeartbeat(); err != nil {
+				client.Logger.Debug("[zinx] client send heartbeat err", "err", err)
+			}
+		case <-client.exitChan:
+			return
+		}
+	}
+}
+
+func (client *Client) connect() error {
+	var conn net.Conn
+	var err error
+	if client.TLSConfig != nil {
+		conn, err = tls.Dial(client.Network, client.Address, client.TLSConfig)
+	} else {
+		conn, err = net.Dial(client.Network, client.Address)
+	}
+	if err != nil {
+		client.Logger.Warn("[zinx] client dial err", "address", client.Address, "err", err)
+		return err
+	}
+	// 建立连接期间客户端已经关闭: Close 已经错过这个连接, 需要在这里关闭
+	client.connLock.Lock()
+	if client.isClosed() {
+		client.connLock.Unlock()
+		conn.Close()
+		return ErrClientClosed
+	}
+	client.conn = conn
+	client.connLock.Unlock()
+	client.Logger.Info("[zinx] client connect success", "address", client.Address)
+	// 新的连接需要重新协商压缩: 不协商时直接使用配置的算法
+	client.compression.set(nil)
+	if client.Compression != "" && client.CompressionID == 0 {
+		client.compression.set(GetCompressor(client.Compression))
+	} else if client.Compression != "" {
+		if err := client.sendMessage(NewMessage(client.CompressionID, []byte(client.Compression))); err != nil {
+			client.Logger.Warn("[zinx] client negotiate compression err", "err", err)
+		}
+	}
+	if client.OnConnStart != nil {
+		client.OnConnStart(client)
+	}
+	return nil
+}
+
+func (client *Client) Close() error {
+	client.exitOnce.Do(func() {
+		close(client.exitChan)
+		client.cancel(ErrClientClosed)
+	})
+	client.connLock.RLock()
+	conn := client.conn
+	client.connLock.RUnlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+func (client *Client) Send(id uint32, data []byte) error {
+	return client.sendMessage(NewMessage(id, data))
+}
+
+func (client *Client) sendMessage(message ziface.IMessage) error {
+	// 1. 获取连接
+	client.connLock.RLock()
+	conn := client.conn
+	client.connLock.RUnlock()
+	if client.isClosed() {
+		return ErrClientClosed
+	}
+	if conn == nil {
+		return ErrClientDisconnected
+	}
+	// 2. 压缩之后编码
+	message = compressMessage(client.compression.get(), client.CompressionThreshold, message)
+	buf, err := encodeBuffer(client.Codec, message)
+	if err != nil {
+		client.Logger.Error("[zinx] client encode buf err", "message_id", message.GetMessageID(), "err", err)
+		return err
+	}
+	// 3. 发送数据
+	client.writeLock.Lock()
+	defer client.writeLock.Unlock()
+	_, err = conn.Write(buf.B)
+	PutBuffer(buf)
+	if err != nil {
+		client.Logger.Warn("[zinx] client write buf err", "message_id", message.GetMessageID(), "err", err)
+		return err
+	}
+	return nil
+}
+
+func (client *Client) Call(id uint32, data []byte, timeout time.Duration) (ziface.IMessage, error) {
+	// 1. 注册等待响应的调用: 编解码器支持序列号时按照序列号匹配, 否则相同消息 ID 的响应按照发送顺序依次交付
+	call := &clientCall{
+		requestID: client.nextRequestID(),
+		wait:      make(chan ziface.IMessage, 1),
+	}
+	client.pendingLock.Lock()
+	client.pending[id] = append(client.pending[id], call)
+	client.pendingLock.Unlock()
+	// 2. 发送请求
+	message := NewMessage(id, data)
+	message.SetRequestID(call.requestID)
+	if err := client.sendMessage(message); err != nil {
+		client.removePending(id, call)
+		return nil, err
+	}
+	// 3. 等待响应
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case response, ok := <-call.wait:
+		if !ok {
+			return nil, ErrClientDisconnected
+		}
+		// 3.1 类型化路由返回的错误
+		if err := parseStatusError(response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	case <-timer.C:
+		client.removePending(id, call)
+		return nil, ErrCallTimeout
+	case <-client.exitChan:
+		client.removePending(id, call)
+		return nil, ErrClientClosed
+	}
+}
+
+func (client *Client) nextRequestID() uint32 {
+	// 序列号 0 表示不携带序列号, 需要跳过
+	for {
+		if requestID := atomic.AddUint32(&client.requestID, 1); requestID != 0 {
+			return requestID
+		}
+	}
+}
+
+// AddHandler 添加处理服务器推送消息的处理器
+// 处理器在单独的协程中按照收到的顺序执行, 读协程不等待处理器, 因此处理器中可以调用 Call 等待响应
+func (client *Client) AddHandler(id uint32, handler ziface.IHandler) {
+	// 1. 检查是否使用了保留位: 注册之后永远不会被调用, 属于编程错误
+	if id&reservedIDBits != 0 {
+		panic(fmt.Sprintf("[zinx] message id %#x use reserved bits %#x in client", id, reservedIDBits))
+	}
+	// 2. 检查是否存在
+	if _, result := client.Apis[id]; result {
+		client.Logger.Warn("[zinx] already exit same message id handler in client", "message_id", id)
+		return
+	}
+	// 3. 添加处理器
+	client.Apis[id] = handler
+}
+
+func (client *Client) SetTLSConfig(config *tls.Config) {
+	client.TLSConfig = config
+}
+
+func (client *Client) SetLogger(logger ziface.ILogger) {
+	client.Logger = logger
+}
+
+func (client *Client) SetCodec(codec ziface.ICodec) {
+	client.Codec = codec
+}
+
+func (client *Client) SetOnConnStart(onConnStart func(connection ziface.IConnection)) {
+	client.OnConnStart = onConnStart
+}
+
+func (client *Client) SetOnConnStop(onConnStop func(connection ziface.IConnection)) {
+	client.OnConnStop = onConnStop
+}
+
+func (client *Client) ReadConn() {
+	defer client.running.Store(false)
+	for {
+		// 1. 读取消息直到连接断开
+		err := client.readMessages()
+		client.Logger.Info("[zinx] client read conn exit", "address", client.Address, "err", err)
+		// 2. 释放连接, 通知所有等待中的调用
+		client.disconnect()
+		// 3. 判断是否需要重连
+		if !client.Reconnect || client.isClosed() {
+			return
+		}
+		if !client.reconnect() {
+			return
+		}
+	}
+}
+
+func (client *Client) readMessages() error {
+	client.connLock.RLock()
+	conn := client.conn
+	client.connLock.RUnlock()
+	codec := client.Codec
+	maxPackage := client.MaxPackage
+	if maxPackage == 0 {
+		maxPackage = defaultClientMaxPackage
+	}
+	reader := bufio.NewReaderSize(conn, readBufferSize)
+	headBuf := make([]byte, codec.GetHeadLength())
+	for {
+		// 1. 读取消息体的头信
+		if _, err := io.ReadFull(reader, headBuf); err != nil {
+			return err
+		}
+		message, err := codec.Decode(headBuf)
+		if err != nil {
+			return err
+		}
+		if message.GetMessageLength() > maxPackage {
+			return ErrPackageTooLarge
+		}
+		// 2. 读取消息体: 消息会交给调用方, 不使用缓冲池
+		dataBuf := make([]byte, message.GetMessageLength())
+		if _, err := io.ReadFull(reader, dataBuf); err != nil {
+			return err
+		}
+		message.SetMessageData(dataBuf)
+		// 3. 压缩协商结果: 服务器选中的算法, 为空表示不压缩
+		if client.CompressionID != 0 && message.GetMessageID() == client.CompressionID {
+			client.compression.set(GetCompressor(string(dataBuf)))
+			client.Logger.Debug("[zinx] client negotiate compression", "compression", string(dataBuf))
+			continue
+		}
+		if err := decompressMessage(client.compression.get(), maxPackage, message); err != nil {
+			return err
+		}
+		// 4. 心跳消息直接处理
+		if handleHeartbeat(client.HeartbeatID, client, message) {
+			continue
+		}
+		// 5. 处理消息
+		client.dispatch(message)
+	}
+}
+
+func (client *Client) dispatch(message ziface.IMessage) {
+	// 1. 优先交付给等待响应的调用
+	if call := client.takePending(message); call != nil {
+		call.wait <- message
+		return
+	}
+	// 2. 交付给处理器
+	handler, result := client.Apis[message.GetMessageID()]
+	if !result {
+		client.Logger.Warn("[zinx] client not found handler to handle message", "message_id", message.GetMessageID())
+		return
+	}
+	// 3. 交给处理器协程: 处理器中调用 Call 时, 读协程仍然可以读取响应
+	request := &Request{
+		Message: message,
+		Conn:    client,
+	}
+	select {
+	case client.handlerQueue <- clientTask{handler: handler, request: request}:
+	case <-client.exitChan:
+	}
+}
+
+// clientTask 等待处理器协程处理的请求
+type clientTask struct {
+	handler ziface.IHandler
+	request ziface.IRequest
+}
+
+// handleRequests 处理器协程: 按照收到的顺序依次执行处理器, 客户端关闭后退出
+func (client *Client) handleRequests() {
+	for {
+		select {
+		case task := <-client.handlerQueue:
+			task.handler.PreHandle(task.request)
+			task.handler.Handle(task.request)
+			task.handler.PostHandle(task.request)
+		case <-client.exitChan:
+			return
+		}
+	}
+}
+
+func (client *Client) disconnect() {
+	// 1. 关闭连接
+	client.connLock.Lock()
+	conn := client.conn
+	client.conn = nil
+	client.connLock.Unlock()
+	if conn == nil {
+		return
+	}
+	conn.Close()
+	// 2. 所有等待中的调用直接失败
+	client.pendingLock.Lock()
+	for id, calls := range client.pending {
+		for _, call := range calls {
+			close(call.wait)
+		}
+		delete(client.pending, id)
+	}
+	client.pendingLock.Unlock()
+	// 3. 执行回调
+	if client.OnConnStop != nil {
+		client.OnConnStop(client)
+	}
+}
+
+func (client *Client) reconnect() bool {
+	delay := client.MinReconnectDelay
+	for {
+		// 1. 退避等待, 关闭后不再重连
+		select {
+		case <-time.After(delay):
+		case <-client.exitChan:
+			return false
+		}
+		// 2. 重新连接
+		if err := client.connect(); err == nil {
+			return true
+		}
+		// 3. 退避时间翻倍
+		delay *= 2
+		if delay > client.MaxReconnectDelay {
+			delay = client.MaxReconnectDelay
+		}
+	}
+}
+
+func (client *Client) takePending(message ziface.IMessage) *clientCall {
+	client.pendingLock.Lock()
+	defer client.pendingLock.Unlock()
+	// 错误响应的消息 ID 带有错误标志, 同样交付给请求的调用
+	id := message.GetMessageID() &^ ErrorFlag
+	calls := client.pending[id]
+	if len(calls) == 0 {
+		return nil
+	}
+	// 1. 没有携带序列号, 交付给最早的调用
+	if message.GetRequestID() == 0 {
+		client.pending[id] = calls[1:]
+		return calls[0]
+	}
+	// 2. 携带序列号, 交付给序列号相同的调用
+	for index, call := range calls {
+		if call.requestID == message.GetRequestID() {
+			client.pending[id] = append(calls[:index:index], calls[index+1:]...)
+			return call
+		}
+	}
+	return nil
+}
+
+func (client *Client) removePending(id uint32, call *clientCall) {
+	client.pendingLock.Lock()
+	defer client.pendingLock.Unlock()
+	calls := client.pending[id]
+	for index, item := range calls {
+		if item == call {
+			client.pending[id] = append(calls[:index:index], calls[index+1:]...)
+			return
+		}
+	}
+}
+
+func (client *Client) isClosed() bool {
+	select {
+	case <-client.exitChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// 以下方法实现 IConnection, 处理器可以通过 request.GetConn() 回复服务器
+
+func (client *Client) StartConn() {
+	if err := client.Dial(); err != nil {
+		client.Logger.Warn("[zinx] client start conn err", "err", err)
+	}
+}
+
+func (client *Client) StopConn() {
+	if err := client.Close(); err != nil {
+		client.Logger.Warn("[zinx] client stop conn err", "err", err)
+	}
+}
+
+func (client *Client) StopConnWithReason(reason error) {
+	client.Logger.Debug("[zinx] client stop conn", "reason", reason)
+	client.StopConn()
+}
+
+// GetState 获取客户端状态: 关闭之后为 closed, 断开重连期间为 connecting
+func (client *Client) GetState() ziface.ConnState {
+	if client.isClosed() {
+		return ziface.ConnStateClosed
+	}
+	if client.GetNetConn() == nil {
+		return ziface.ConnStateConnecting
+	}
+	return ziface.ConnStateActive
+}
+
+func (client *Client) Done() <-chan struct{} {
+	return client.exitChan
+}
+
+// Context 客户端关闭时取消, 断开重连不会取消
+func (client *Client) Context() context.Context {
+	return client.ctx
+}
+
+// GetCloseReason 客户端只能主动关闭, 关闭之后返回 ErrClientClosed
+func (client *Client) GetCloseReason() error {
+	if client.isClosed() {
+		return ErrClientClosed
+	}
+	return nil
+}
+
+func (client *Client) GetTCPConn() *net.TCPConn {
+	client.connLock.RLock()
+	defer client.connLock.RUnlock()
+	conn, _ := client.conn.(*net.TCPConn)
+	return conn
+}
+
+func (client *Client) GetNetConn() net.Conn {
+	client.connLock.RLock()
+	defer client.connLock.RUnlock()
+	return client.conn
+}
+
+func (client *Client) GetPeerCertificate() *x509.Certificate {
+	return peerCertificate(client.GetNetConn())
+}
+
+// GetIdentity 客户端不认证服务器, 始终返回 nil
+func (client *Client) GetIdentity() ziface.IIdentity {
+	return nil
+}
+
+func (client *Client) GetConnID() uint32 {
+	return 0
+}
+
+func (client *Client) RemoteAddr() net.Addr {
+	client.connLock.RLock()
+	defer client.connLock.RUnlock()
+	if client.conn == nil {
+		return nil
+	}
+	return client.conn.RemoteAddr()
+}
+
+func (client *Client) SendMessage(id uint32, data []byte) error {
+	return client.Send(id, data)
+}
+
+func (client *Client) SendMessageBlocking(ctx context.Context, id uint32, data []byte) error {
+	// 客户端同步写入, 只需要检查 ctx 是否已经结束
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return client.Send(id, data)
+}
+
+func (client *Client) SendHeartbeat() error {
+	return client.Send(client.HeartbeatID, []byte(HeartbeatPing))
+}
+
+func (client *Client) Reply(request ziface.IRequest, data []byte) error {
+	if err := claimReply(request); err != nil {
+		return err
+	}
+	message := NewMessage(request.GetMessage().GetMessageID(), data)
+	message.SetRequestID(request.GetRequestID())
+	return client.sendMessage(message)
+}
+
+func (client *Client) GetLogger() ziface.ILogger {
+	return client.Logger
+}
+
+func (client *Client) SetConnectionProperty(key string, value interface{}) {
+	client.propertyLock.Lock()
+	defer client.propertyLock.Unlock()
+	client.properties[key] = value
+}
+
+func (client *Client) GetConnectionProperty(key string) (value interface{}) {
+	client.propertyLock.RLock()
+	defer client.propertyLock.RUnlock()
+	return client.properties[key]
+}
+
+func (client *Client) RemoveConnectionProperty(key string) {
+	client.propertyLock.Lock()
+	defer client.propertyLock.Unlock()
+	delete(client.properties, key)
+}
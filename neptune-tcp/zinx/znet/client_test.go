@@ -0,0 +1,189 @@
+package znet
+
+import (
+	"errors"
+	"io"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestClient 创建连接到本地监听器的客户端, 监听器接收的连接通过管道交给测试
+func newTestClient(t *testing.T) (*Client, chan net.Conn) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	accepted := make(chan net.Conn, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	client := NewClient("127.0.0.1", 0)
+	client.Address = listener.Addr().String()
+	client.Logger = zlog.NewNopLogger()
+	client.MinReconnectDelay = time.Millisecond
+	client.MaxReconnectDelay = 10 * time.Millisecond
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client, accepted
+}
+
+func accept(t *testing.T, accepted chan net.Conn) net.Conn {
+	t.Helper()
+	select {
+	case conn := <-accepted:
+		return conn
+	case <-time.After(time.Second):
+		t.Fatal("client not connected")
+		return nil
+	}
+}
+
+func TestClientConcurrentDial(t *testing.T) {
+	client, accepted := newTestClient(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.Dial(); err != nil {
+				t.Errorf("dial err = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	accept(t, accepted)
+	select {
+	case <-accepted:
+		t.Fatal("concurrent dial opened more than one connection")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestClientConnectAfterClose(t *testing.T) {
+	client, accepted := newTestClient(t)
+	_ = client.Close()
+	// 建立连接期间客户端关闭: 新的连接被关闭, 不会泄漏
+	if err := client.connect(); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("connect err = %v", err)
+	}
+	peer := accept(t, accepted)
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := peer.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("leaked conn read err = %v", err)
+	}
+	if client.GetNetConn() != nil || client.GetState() != ziface.ConnStateClosed {
+		t.Fatalf("client state = %s", client.GetState())
+	}
+	if err := client.Dial(); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("dial after close err = %v", err)
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	client, accepted := newTestClient(t)
+	stops := make(chan struct{}, 4)
+	client.OnConnStop = func(connection ziface.IConnection) {
+		stops <- struct{}{}
+	}
+	if err := client.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	// 1. 服务器断开连接, 客户端自动重连
+	_ = accept(t, accepted).Close()
+	<-stops
+	peer := accept(t, accepted)
+	// 2. 重连之后可以正常收发
+	if err := client.Send(1, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if id, data := readFrame(t, peer); id != 1 || string(data) != "ping" {
+		t.Fatalf("frame = %d %q", id, data)
+	}
+	// 3. 关闭之后不再重连
+	_ = client.Close()
+	<-stops
+	select {
+	case <-accepted:
+		t.Fatal("client reconnected after close")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if client.GetState() != ziface.ConnStateClosed {
+		t.Fatalf("client state = %s", client.GetState())
+	}
+}
+
+func TestClientCall(t *testing.T) {
+	client, accepted := newTestClient(t)
+	if err := client.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	peer := accept(t, accepted)
+	go func() {
+		head := make([]byte, 8)
+		if _, err := io.ReadFull(peer, head); err != nil {
+			return
+		}
+		request, _ := NewCodec().Decode(head)
+		data := make([]byte, request.GetMessageLength())
+		_, _ = io.ReadFull(peer, data)
+		buf, _ := NewCodec().Encode(NewMessage(request.GetMessageID(), append(data, '!')))
+		_, _ = peer.Write(buf)
+	}()
+	response, err := client.Call(1, []byte("ping"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(response.GetMessageData()) != "ping!" {
+		t.Fatalf("response = %q", response.GetMessageData())
+	}
+	// 没有响应时超时
+	if _, err := client.Call(2, nil, 10*time.Millisecond); !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("call err = %v", err)
+	}
+}
+
+func TestClientCallInHandler(t *testing.T) {
+	client, accepted := newTestClient(t)
+	results := make(chan string, 1)
+	// 处理器中调用 Call: 响应由读协程读取, 不会死锁
+	client.AddHandler(5, &testHandler{handle: func(request ziface.IRequest) {
+		response, err := client.Call(1, []byte("ping"), time.Second)
+		if err != nil {
+			results <- err.Error()
+			return
+		}
+		results <- string(response.GetMessageData())
+	}})
+	if err := client.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	peer := accept(t, accepted)
+	writeFrame(t, peer, 5, []byte("push"))
+	if id, data := readFrame(t, peer); id != 1 || string(data) != "ping" {
+		t.Fatalf("frame = %d %q", id, data)
+	}
+	writeFrame(t, peer, 1, []byte("pong"))
+	select {
+	case result := <-results:
+		if result != "pong" {
+			t.Fatalf("result = %q", result)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("call in handler blocked")
+	}
+}
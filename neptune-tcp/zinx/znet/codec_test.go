@@ -0,0 +1,178 @@
+package znet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"testing"
+	"time"
+)
+
+// roundTrip 编码之后按照头部和消息体两步解码
+func roundTrip(t *testing.T, codec ziface.ICodec, message ziface.IMessage) ziface.IMessage {
+	t.Helper()
+	buf, err := codec.Encode(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != int(codec.GetHeadLength()+message.GetMessageLength()) {
+		t.Fatalf("encoded length = %d", len(buf))
+	}
+	decoded, err := codec.Decode(buf[:codec.GetHeadLength()])
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded.SetMessageData(buf[codec.GetHeadLength():])
+	return decoded
+}
+
+func TestBigEndianCodecRoundTrip(t *testing.T) {
+	codec := NewBigEndianCodec()
+	for _, data := range [][]byte{nil, []byte("ping"), bytes.Repeat([]byte("z"), 4096)} {
+		decoded := roundTrip(t, codec, NewMessage(0x01020304, data))
+		if decoded.GetMessageID() != 0x01020304 || int(decoded.GetMessageLength()) != len(data) || !bytes.Equal(decoded.GetMessageData(), data) {
+			t.Fatalf("decoded = %d %d %q", decoded.GetMessageID(), decoded.GetMessageLength(), decoded.GetMessageData())
+		}
+	}
+	// 头部按照大端序写入
+	buf, _ := codec.Encode(NewMessage(0x01020304, []byte("ab")))
+	if buf[0] != BigEndianCodecMagic || buf[1] != BigEndianCodecVersion || binary.BigEndian.Uint32(buf[2:6]) != 0x01020304 || binary.BigEndian.Uint32(buf[6:10]) != 2 {
+		t.Fatalf("head = % x", buf[:10])
+	}
+}
+
+func TestBigEndianCodecDecodeErrors(t *testing.T) {
+	codec := NewBigEndianCodec()
+	buf, _ := codec.Encode(NewMessage(1, nil))
+	if _, err := codec.Decode(buf[:5]); err == nil {
+		t.Fatal("short head decoded")
+	}
+	badMagic := append([]byte(nil), buf...)
+	badMagic[0] = 0
+	if _, err := codec.Decode(badMagic); err == nil {
+		t.Fatal("bad magic decoded")
+	}
+	badVersion := append([]byte(nil), buf...)
+	badVersion[1] = BigEndianCodecVersion + 1
+	if _, err := codec.Decode(badVersion); err == nil {
+		t.Fatal("bad version decoded")
+	}
+}
+
+func TestServerWithCodec(t *testing.T) {
+	codec := NewBigEndianCodec()
+	server := newTestServer(t, WithCodec(codec))
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		_ = request.GetConn().SendMessage(2, request.GetMessage().GetMessageData())
+	}})
+	server.Router.StartWorkerPool()
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	// 连接使用服务器的编解码器读写
+	buf, _ := codec.Encode(NewMessage(1, []byte("ping")))
+	if _, err := peer.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	head := make([]byte, codec.GetHeadLength())
+	if _, err := io.ReadFull(peer, head); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := codec.Decode(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, reply.GetMessageLength())
+	if _, err := io.ReadFull(peer, data); err != nil {
+		t.Fatal(err)
+	}
+	if reply.GetMessageID() != 2 || string(data) != "ping" {
+		t.Fatalf("reply = %d %q", reply.GetMessageID(), data)
+	}
+}
+
+func TestSequenceCodecRoundTrip(t *testing.T) {
+	codec := NewSequenceCodec()
+	message := NewMessage(7, []byte("ping"))
+	message.SetRequestID(0xdeadbeef)
+	decoded := roundTrip(t, codec, message)
+	if decoded.GetMessageID() != 7 || decoded.GetRequestID() != 0xdeadbeef || string(decoded.GetMessageData()) != "ping" {
+		t.Fatalf("decoded = %d %d %q", decoded.GetMessageID(), decoded.GetRequestID(), decoded.GetMessageData())
+	}
+	// 默认编解码器不携带请求序列号
+	if decoded := roundTrip(t, NewCodec(), message); decoded.GetRequestID() != 0 {
+		t.Fatalf("default codec request id = %d", decoded.GetRequestID())
+	}
+}
+
+func TestReplyKeepsRequestID(t *testing.T) {
+	codec := NewSequenceCodec()
+	server := newTestServer(t, WithCodec(codec))
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		_ = request.GetConn().Reply(request, request.GetMessage().GetMessageData())
+	}})
+	server.Router.StartWorkerPool()
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	message := NewMessage(1, []byte("ping"))
+	message.SetRequestID(42)
+	buf, _ := codec.Encode(message)
+	if _, err := peer.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	head := make([]byte, codec.GetHeadLength())
+	if _, err := io.ReadFull(peer, head); err != nil {
+		t.Fatal(err)
+	}
+	reply, _ := codec.Decode(head)
+	if reply.GetMessageID() != 1 || reply.GetRequestID() != 42 {
+		t.Fatalf("reply = %d %d", reply.GetMessageID(), reply.GetRequestID())
+	}
+}
+
+func TestClientCallMatchesRequestID(t *testing.T) {
+	client, accepted := newTestClient(t)
+	client.Codec = NewSequenceCodec()
+	if err := client.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	peer := accept(t, accepted)
+	// 服务器读取两个请求之后按照相反的顺序回复
+	go func() {
+		codec := NewSequenceCodec()
+		var requests []ziface.IMessage
+		for len(requests) < 2 {
+			head := make([]byte, codec.GetHeadLength())
+			if _, err := io.ReadFull(peer, head); err != nil {
+				return
+			}
+			request, _ := codec.Decode(head)
+			data := make([]byte, request.GetMessageLength())
+			_, _ = io.ReadFull(peer, data)
+			request.SetMessageData(data)
+			requests = append(requests, request)
+		}
+		for i := len(requests) - 1; i >= 0; i-- {
+			buf, _ := codec.Encode(requests[i])
+			_, _ = peer.Write(buf)
+		}
+	}()
+	results := make(chan string, 2)
+	for _, data := range []string{"first", "second"} {
+		go func(data string) {
+			response, err := client.Call(1, []byte(data), time.Second)
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			results <- data + "=" + string(response.GetMessageData())
+		}(data)
+	}
+	for i := 0; i < 2; i++ {
+		if result := <-results; result != "first=first" && result != "second=second" {
+			t.Fatalf("result = %s", result)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package znet
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CompressedFlag 消息 ID 的最高位: 表示消息内容已经压缩, 应用的消息 ID 不能使用最高位
+const CompressedFlag uint32 = 1 << 31
+
+// reservedIDBits 消息 ID 的保留位: 压缩标志和错误标志, 注册处理器时不能使用
+const reservedIDBits = CompressedFlag | ErrorFlag
+
+var (
+	ErrDecompressTooLarge       = errors.New("[zinx] decompressed message too large")
+	ErrCompressionNotNegotiated = errors.New("[zinx] receive compressed message without negotiated compression")
+)
+
+// 已经注册的压缩算法: 算法名称 -> 压缩算法
+var (
+	compressors = map[string]ziface.ICompressor{
+		"gzip":  NewGzipCompressor(),
+		"flate": NewFlateCompressor(),
+	}
+	compressorLock sync.RWMutex
+)
+
+// RegisterCompressor 注册压缩算法, 例如基于第三方库的 zstd 或者 snappy; 同名算法会被覆盖
+func RegisterCompressor(compressor ziface.ICompressor) {
+	compressorLock.Lock()
+	defer compressorLock.Unlock()
+	compressors[compressor.Name()] = compressor
+}
+
+// GetCompressor 获取已经注册的压缩算法, 不存在时返回 nil
+func GetCompressor(name string) ziface.ICompressor {
+	compressorLock.RLock()
+	defer compressorLock.RUnlock()
+	return compressors[name]
+}
+
+// GzipCompressor gzip 压缩算法: 复用压缩器, 减少内存分配
+type GzipCompressor struct {
+	writers sync.Pool
+}
+
+func NewGzipCompressor() *GzipCompressor {
+	return &GzipCompressor{}
+}
+
+func (compressor *GzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (compressor *GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, ok := compressor.writers.Get().(*gzip.Writer)
+	if ok {
+		writer.Reset(&buf)
+	} else {
+		writer = gzip.NewWriter(&buf)
+	}
+	defer compressor.writers.Put(writer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (compressor *GzipCompressor) Decompress(data []byte, limit uint32) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readLimited(reader, limit)
+}
+
+// FlateCompressor deflate 压缩算法: 没有 gzip 的头部和校验, 适合较小的消息
+type FlateCompressor struct {
+	writers sync.Pool
+}
+
+func NewFlateCompressor() *FlateCompressor {
+	return &FlateCompressor{}
+}
+
+func (compressor *FlateCompressor) Name() string {
+	return "flate"
+}
+
+func (compressor *FlateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, ok := compressor.writers.Get().(*flate.Writer)
+	if ok {
+		writer.Reset(&buf)
+	} else {
+		var err error
+		if writer, err = flate.NewWriter(&buf, flate.DefaultCompression); err != nil {
+			return nil, err
+		}
+	}
+	defer compressor.writers.Put(writer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (compressor *FlateCompressor) Decompress(data []byte, limit uint32) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+	return readLimited(reader, limit)
+}
+
+// readLimited 读取解压后的内容, 避免压缩炸弹占用大量内存
+func readLimited(reader io.Reader, limit uint32) ([]byte, error) {
+	if limit == 0 {
+		return io.ReadAll(reader)
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > int(limit) {
+		return nil, ErrDecompressTooLarge
+	}
+	return data, nil
+}
+
+// compression 连接协商的压缩算法: 为空表示不压缩, 读协程设置, 发送消息的协程读取
+type compression struct {
+	value atomic.Pointer[compressionValue]
+}
+
+type compressionValue struct {
+	compressor ziface.ICompressor
+}
+
+func (compression *compression) get() ziface.ICompressor {
+	if value := compression.value.Load(); value != nil {
+		return value.compressor
+	}
+	return nil
+}
+
+func (compression *compression) set(compressor ziface.ICompressor) {
+	compression.value.Store(&compressionValue{compressor: compressor})
+}
+
+// compressMessage 消息内容达到阈值时压缩, 压缩后更小才使用压缩结果; 压缩失败时发送原始消息
+func compressMessage(compressor ziface.ICompressor, threshold uint32, message ziface.IMessage) ziface.IMessage {
+	if compressor == nil || message.GetMessageLength() < threshold || message.GetMessageID()&CompressedFlag != 0 {
+		return message
+	}
+	data, err := compressor.Compress(message.GetMessageData())
+	if err != nil || len(data) >= int(message.GetMessageLength()) {
+		return message
+	}
+	compressed := NewMessage(message.GetMessageID()|CompressedFlag, data)
+	compressed.SetRequestID(message.GetRequestID())
+	return compressed
+}
+
+// decompressMessage 解压带有压缩标志的消息: 替换消息 ID 和内容, 原来的消息内容放回缓冲池
+func decompressMessage(compressor ziface.ICompressor, limit uint32, message ziface.IMessage) error {
+	if message.GetMessageID()&CompressedFlag == 0 {
+		return nil
+	}
+	if compressor == nil {
+		return ErrCompressionNotNegotiated
+	}
+	data, err := compressor.Decompress(message.GetMessageData(), limit)
+	if err != nil {
+		return err
+	}
+	releaseMessage(message)
+	message.SetMessageID(message.GetMessageID() &^ CompressedFlag)
+	message.SetMessageData(data)
+	message.SetMessageLength(uint32(len(data)))
+	return nil
+}
+
+// selectCompression 从对方支持的算法列表 (逗号分隔) 中选择本地配置的算法, 对方不支持时返回空
+func selectCompression(local string, remote string) string {
+	for _, name := range strings.Split(remote, ",") {
+		if strings.TrimSpace(name) == local && GetCompressor(local) != nil {
+			return local
+		}
+	}
+	return ""
+}
+
+// negotiateCompression 处理压缩协商消息: 客户端发送支持的算法列表, 服务器回复选中的算法, 为空表示不压缩; 返回是否是协商消息
+func (conn *Connection) negotiateCompression(config *utils.Configuration, message ziface.IMessage) bool {
+	// 1. 检查是否是协商消息
+	if config.ZinxCompressionID == 0 || message.GetMessageID() != config.ZinxCompressionID {
+		return false
+	}
+	// 2. 先回复协商结果, 之后发送的消息才会压缩
+	selected := selectCompression(config.ZinxCompression, string(message.GetMessageData()))
+	if err := conn.SendMessage(config.ZinxCompressionID, []byte(selected)); err != nil {
+		conn.Logger.Warn("[zinx] reply compression negotiation err", "err", err)
+		return true
+	}
+	conn.compression.set(GetCompressor(selected))
+	conn.Logger.Debug("[zinx] negotiate compression", "compression", selected)
+	return true
+}
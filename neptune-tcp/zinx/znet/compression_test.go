@@ -0,0 +1,217 @@
+package znet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"testing"
+	"time"
+)
+
+// newCompressionServer 创建回显消息内容的服务器, 压缩协商消息 ID 为 100, 阈值为 16 字节
+func newCompressionServer(t *testing.T) *Server {
+	t.Helper()
+	config := utils.NewConfiguration()
+	config.ZinxCompression = "gzip"
+	config.ZinxCompressionID = 100
+	config.ZinxCompressionThreshold = 16
+	server := newTestServer(t, WithConfig(config))
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		_ = request.GetConn().Reply(request, request.GetMessage().GetMessageData())
+	}})
+	server.Router.StartWorkerPool()
+	t.Cleanup(func() {
+		_ = server.Router.StopWorkerPool(context.Background())
+	})
+	return server
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	server := newCompressionServer(t)
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	gzip := GetCompressor("gzip")
+	// 1. 对端发送支持的算法列表, 服务器选中本地配置的算法
+	writeFrame(t, peer, 100, []byte("flate,gzip"))
+	if id, data := readFrame(t, peer); id != 100 || string(data) != "gzip" {
+		t.Fatalf("negotiation = %d %q", id, data)
+	}
+	// 2. 达到阈值的回复被压缩
+	payload := bytes.Repeat([]byte("zinx"), 64)
+	compressed, err := gzip.Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFrame(t, peer, 1|CompressedFlag, compressed)
+	id, data := readFrame(t, peer)
+	if id != 1|CompressedFlag {
+		t.Fatalf("reply id = %#x, want compressed", id)
+	}
+	if data, err = gzip.Decompress(data, 0); err != nil || !bytes.Equal(data, payload) {
+		t.Fatalf("decompress reply = %q, %v", data, err)
+	}
+	// 3. 低于阈值的回复不压缩
+	writeFrame(t, peer, 1, []byte("small"))
+	if id, data := readFrame(t, peer); id != 1 || string(data) != "small" {
+		t.Fatalf("small reply = %#x %q", id, data)
+	}
+}
+
+func TestCompressionUnsupported(t *testing.T) {
+	server := newCompressionServer(t)
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	// 对端不支持服务器配置的算法: 回复为空, 之后的消息不压缩
+	writeFrame(t, peer, 100, []byte("snappy"))
+	if id, data := readFrame(t, peer); id != 100 || len(data) != 0 {
+		t.Fatalf("negotiation = %d %q", id, data)
+	}
+	payload := bytes.Repeat([]byte("zinx"), 64)
+	writeFrame(t, peer, 1, payload)
+	if id, data := readFrame(t, peer); id != 1 || !bytes.Equal(data, payload) {
+		t.Fatalf("reply = %#x %d bytes", id, len(data))
+	}
+}
+
+func TestCompressionOldClient(t *testing.T) {
+	server := newCompressionServer(t)
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	// 1. 没有协商的旧客户端: 超过阈值的回复同样不压缩
+	payload := bytes.Repeat([]byte("zinx"), 64)
+	writeFrame(t, peer, 1, payload)
+	if id, data := readFrame(t, peer); id != 1 || !bytes.Equal(data, payload) {
+		t.Fatalf("reply = %#x %d bytes", id, len(data))
+	}
+	// 2. 没有协商却发送压缩消息: 关闭连接
+	compressed, _ := GetCompressor("gzip").Compress(payload)
+	writeFrame(t, peer, 1|CompressedFlag, compressed)
+	waitDone(t, conn)
+	if !errors.Is(conn.GetCloseReason(), ErrCompressionNotNegotiated) {
+		t.Fatalf("reason = %v", conn.GetCloseReason())
+	}
+}
+
+func TestCompressionDecompressLimit(t *testing.T) {
+	config := utils.NewConfiguration()
+	config.ZinxCompression = "flate"
+	config.ZinxCompressionID = 100
+	config.ZinxMaxPackage = 64
+	server := newTestServer(t, WithConfig(config))
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	writeFrame(t, peer, 100, []byte("flate"))
+	readFrame(t, peer)
+	// 压缩后没有超过消息长度的限制, 解压后超过限制: 关闭连接
+	compressed, _ := GetCompressor("flate").Compress(make([]byte, 4096))
+	writeFrame(t, peer, 1|CompressedFlag, compressed)
+	waitDone(t, conn)
+	if !errors.Is(conn.GetCloseReason(), ErrDecompressTooLarge) {
+		t.Fatalf("reason = %v", conn.GetCloseReason())
+	}
+}
+
+func TestClientCompressionNegotiation(t *testing.T) {
+	server := newCompressionServer(t)
+	address := startTestServer(t, server)
+	client := NewClient("127.0.0.1", 0)
+	client.Address = address
+	client.Logger = zlog.NewNopLogger()
+	client.Compression = "gzip"
+	client.CompressionID = 100
+	client.CompressionThreshold = 16
+	if err := client.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// 等待协商结果: 协商完成之前的消息不压缩, 回复同样可以正常处理
+	deadline := time.Now().Add(time.Second)
+	for client.compression.get() == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if client.compression.get() == nil {
+		t.Fatal("compression not negotiated")
+	}
+	payload := bytes.Repeat([]byte("zinx"), 64)
+	reply, err := client.Call(1, payload, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.GetMessageID() != 1 || !bytes.Equal(reply.GetMessageData(), payload) {
+		t.Fatalf("reply = %#x %d bytes", reply.GetMessageID(), len(reply.GetMessageData()))
+	}
+}
+
+func TestClientDecompressLimit(t *testing.T) {
+	client, accepted := newTestClient(t)
+	client.Reconnect = false
+	client.Compression = "gzip"
+	client.MaxPackage = 64
+	if err := client.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	peer := accept(t, accepted)
+	defer peer.Close()
+	// 解压后超过最大长度: 客户端断开连接
+	compressed, _ := GetCompressor("gzip").Compress(make([]byte, 4096))
+	writeFrame(t, peer, 1|CompressedFlag, compressed)
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := peer.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("peer read err = %v, want EOF", err)
+	}
+}
+
+func TestClientDecompressDefaultLimit(t *testing.T) {
+	client, accepted := newTestClient(t)
+	client.Reconnect = false
+	client.Compression = "gzip"
+	if client.MaxPackage != utils.NewConfiguration().ZinxMaxPackage {
+		t.Fatalf("default max package = %d", client.MaxPackage)
+	}
+	// 0 同样使用默认值, 不会取消限制
+	client.MaxPackage = 0
+	if err := client.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	peer := accept(t, accepted)
+	defer peer.Close()
+	// 压缩后很小, 解压后超过默认的最大长度: 客户端断开连接
+	compressed, _ := GetCompressor("gzip").Compress(make([]byte, 1<<20))
+	writeFrame(t, peer, 1|CompressedFlag, compressed)
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := peer.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("peer read err = %v, want EOF", err)
+	}
+}
+
+func TestAddHandlerReservedBits(t *testing.T) {
+	router := newTestRouter(DispatchModeHash, 4)
+	client := NewClient("127.0.0.1", 0)
+	client.Logger = zlog.NewNopLogger()
+	// 使用保留位注册处理器是编程错误: 直接 panic, 不会静默丢弃处理器
+	mustPanic := func(name string, id uint32, add func(id uint32, handler ziface.IHandler)) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("%s registered reserved id %#x without panic", name, id)
+			}
+		}()
+		add(id, &BaseHandler{})
+	}
+	for _, id := range []uint32{1 | CompressedFlag, 1 | ErrorFlag} {
+		mustPanic("router", id, router.AddHandler)
+		mustPanic("client", id, client.AddHandler)
+		if _, ok := router.Apis[id]; ok {
+			t.Fatalf("router registered reserved id %#x", id)
+		}
+		if _, ok := client.Apis[id]; ok {
+			t.Fatalf("client registered reserved id %#x", id)
+		}
+	}
+}
@@ -1,72 +1,267 @@
 package znet
 
 import (
-	"fmt"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"io"
 	"neptune-golang/neptune-tcp/zinx/utils"
 	"neptune-golang/neptune-tcp/zinx/ziface"
 	"net"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// 发送队列已满时的策略, 定义在配置中
+const (
+	SendQueuePolicyDrop       = utils.SendQueuePolicyDrop
+	SendQueuePolicyBlock      = utils.SendQueuePolicyBlock
+	SendQueuePolicyDisconnect = utils.SendQueuePolicyDisconnect
+)
+
+var (
+	ErrPackageTooLarge = errors.New("[zinx] receive package size too large")
+	ErrSendQueueFull   = errors.New("[zinx] send queue full")
+	ErrConnClosed      = errors.New("[zinx] conn already closed")
+	// 连接关闭的原因: 其余原因为读写错误或者其他模块定义的错误
+	ErrConnStopped   = errors.New("[zinx] conn stopped")
+	ErrConnIdle      = errors.New("[zinx] conn idle timeout")
+	ErrConnKicked    = errors.New("[zinx] conn kicked")
+	ErrServerStopped = errors.New("[zinx] server stopped")
+)
+
+// 关闭连接的钩子函数发送的消息最多等待写入的时间, 阻塞发送最多等待发送队列的时间
+const stopFlushTimeout = time.Second
+
 type Connection struct {
 	// 连接 ID
 	ConnID uint32
-	// 连接
-	Conn *net.TCPConn
-	// 连接状态
-	isClosed bool
+	// 连接: TCP 或者 TLS 连接
+	Conn net.Conn
+	// 连接状态: 原子地按照 connecting -> active -> closing -> closed 变化
+	state atomic.Int32
+	// 关闭的原因和关闭的通知管道
+	closeReason atomic.Pointer[error]
+	done        chan struct{}
+	// 连接的上下文: 关闭连接时取消, 请求的上下文继承自连接
+	ctx    context.Context
+	cancel context.CancelCauseFunc
 	// 处理器
 	Router ziface.IRouter
-	// TODO 负责交换退出消息的管道 (goroutine)
-	ExitChan chan bool
-	// TODO 负责交换客户端消息的管道
-	MessageChan chan []byte
+	// 编解码器: 继承自所属服务器
+	Codec ziface.ICodec
+	// 负责交换客户端消息的有界管道
+	MessageChan chan *Buffer
+	// 发送队列中和正在写入的消息数量: 停止服务器时等待回复写入
+	queued atomic.Int32
+	// 是否正在执行关闭的钩子函数: 钩子函数执行期间仍然可以发送消息, 发送了消息时关闭连接之前等待写入
+	stopping atomic.Bool
+	stopSent atomic.Bool
+	// 是否写入失败: 写协程已经退出, 关闭连接时不再等待发送队列
+	writeFailed atomic.Bool
+	// 发送队列已满时的策略
+	SendQueuePolicy string
+	// 写协程合并写入: 每次最多合并的消息数量和最多等待的时间
+	WriteBatchSize     int
+	WriteFlushInterval time.Duration
 	// 连接所属服务器
 	Server ziface.IServer
+	// 日志: 携带连接 ID 和客户端地址
+	Logger ziface.ILogger
+	// 限流器: 连接的限流器为空表示不限流, 消息 ID 的限流器只在读协程中访问
+	rateLimiter         ziface.IRateLimiter
+	messageRateLimiters map[uint32]*TokenBucket
 	// 附加参数
 	properties   map[string]interface{}
 	propertyLock sync.RWMutex
+	// 事件循环模式: 为空表示使用读写协程
+	poller  poller
+	rawConn syscall.RawConn
+	fd      int
+	// 事件循环模式: 读取到的不完整消息和最后一次读取的时间, 只在事件循环中访问
+	pending  []byte
+	lastRead time.Time
+	// 事件循环模式: 是否有正在运行的写协程
+	writing atomic.Bool
+	// 协商的压缩算法和压缩阈值
+	compression          compression
+	compressionThreshold uint32
+	// 认证器: 为空表示不需要认证; 认证阶段已经处理的消息数量只在读协程中访问
+	authenticator ziface.IAuthenticator
+	authMessages  uint32
+	authTimer     *time.Timer
+	identity      identity
+}
+
+// poller 事件循环: 负责读取连接的数据, 不需要为每个连接启动常驻的读写协程
+type poller interface {
+	add(conn *Connection) error
+	remove(conn *Connection)
+	close()
 }
 
 func (conn *Connection) StartConn() {
-	fmt.Println("Conn Start... ConnID", conn.ConnID)
-	// 1. 执行读取函数
-	go conn.ReadConn()
-	// 2. 执行写入函数
-	go conn.WriteConn()
+	conn.Logger.Debug("[zinx] conn start")
+	// 0. TLS 连接需要先完成握手, 钩子函数中才能获取客户端证书
+	if err := conn.handshake(); err != nil {
+		conn.Logger.Warn("[zinx] tls handshake err", "err", err)
+		conn.StopConnWithReason(err)
+		return
+	}
+	// 0.1 握手期间已经被关闭 (例如服务器停止) 则不再启动
+	if !conn.state.CompareAndSwap(int32(ziface.ConnStateConnecting), int32(ziface.ConnStateActive)) {
+		return
+	}
+	// 1. 事件循环模式: 由事件循环读取, 发送队列中有消息时才启动写协程
+	if conn.poller != nil {
+		if err := conn.poller.add(conn); err != nil {
+			conn.Logger.Warn("[zinx] add conn to event loop err", "err", err)
+			conn.StopConnWithReason(err)
+			return
+		}
+	} else {
+		// 1.1 执行读取函数
+		go conn.ReadConn()
+		// 1.2 执行写入函数
+		go conn.WriteConn()
+	}
 	// 3. 执行回调
 	conn.Server.GetOnConnStart(conn)
 }
 
 func (conn *Connection) StopConn() {
-	fmt.Println("Conn Stop.. ConnID", conn.ConnID)
-	// 1. 检查连接是否已经关闭
-	if conn.isClosed {
-		fmt.Println("connection already close, ConnID", conn.ConnID)
+	conn.StopConnWithReason(ErrConnStopped)
+}
+
+func (conn *Connection) StopConnWithReason(reason error) {
+	if conn.beginStop(reason) {
+		conn.finishStop()
+	}
+}
+
+// stopAsync 读取或者发送过程中关闭连接: 事件循环模式下连接状态立即变为关闭中, 并且不再读取,
+// 钩子函数和等待写入在单独的协程中执行, 不阻塞同一个事件循环中的其他连接; 其他模式直接关闭
+func (conn *Connection) stopAsync(reason error) {
+	if conn.poller == nil {
+		conn.StopConnWithReason(reason)
 		return
 	}
-	// 2. 执行回调
+	if conn.beginStop(reason) {
+		conn.poller.remove(conn)
+		go conn.finishStop()
+	}
+}
+
+// beginStop 连接状态变为关闭中并记录关闭的原因, 返回是否是第一次关闭
+func (conn *Connection) beginStop(reason error) bool {
+	// 1. 只有第一次关闭生效: 读协程, 写协程, 连接管理器等可能同时关闭连接
+	for {
+		state := conn.GetState()
+		if state >= ziface.ConnStateClosing {
+			conn.Logger.Debug("[zinx] conn already close")
+			return false
+		}
+		if conn.state.CompareAndSwap(int32(state), int32(ziface.ConnStateClosing)) {
+			break
+		}
+	}
+	if reason == nil {
+		reason = ErrConnStopped
+	}
+	conn.closeReason.Store(&reason)
+	conn.cancel(reason)
+	conn.Logger.Debug("[zinx] conn stop", "reason", reason)
+	conn.stopAuth()
+	return true
+}
+
+// finishStop 执行钩子函数, 等待写入之后关闭连接
+func (conn *Connection) finishStop() {
+	// 2. 执行回调: 钩子函数中可以获取关闭的原因, 仍然可以发送消息, 关闭连接之前等待写入
+	conn.stopping.Store(true)
 	conn.Server.GetOnConnStop(conn)
-	// 3. 如果没有关闭, 那么关闭连接
-	conn.isClosed = true
+	conn.stopping.Store(false)
+	conn.flushOnStop()
+	// 3. 关闭连接: 事件循环模式需要先从事件循环中移除
+	if conn.poller != nil {
+		conn.poller.remove(conn)
+	}
 	if err := conn.Conn.Close(); err != nil {
-		fmt.Println("Conn Stop err, ConnID", err, conn.ConnID)
+		conn.Logger.Warn("[zinx] conn stop err", "err", err)
 	}
-	// 4. 关闭之前发送关闭消息
-	conn.ExitChan <- true
-	// TODO 4. 释放管道资源
-	close(conn.ExitChan)
-	close(conn.MessageChan)
+	// 4. 通知写协程和等待发送队列的协程退出: 发送队列不关闭, 避免关闭后发送消息导致异常
+	close(conn.done)
+	conn.state.Store(int32(ziface.ConnStateClosed))
 	// 5. 移除连接
 	conn.Server.GetConnManager().CloseConnection(conn)
 }
 
+func (conn *Connection) GetState() ziface.ConnState {
+	return ziface.ConnState(conn.state.Load())
+}
+
+func (conn *Connection) Done() <-chan struct{} {
+	return conn.done
+}
+
+func (conn *Connection) Context() context.Context {
+	return conn.ctx
+}
+
+func (conn *Connection) GetCloseReason() error {
+	if reason := conn.closeReason.Load(); reason != nil {
+		return *reason
+	}
+	return nil
+}
+
+// isClosed 连接正在关闭或者已经关闭
+func (conn *Connection) isClosed() bool {
+	return conn.GetState() >= ziface.ConnStateClosing
+}
+
+// isSendClosed 连接是否不能再发送消息: 关闭的钩子函数执行期间仍然可以发送
+func (conn *Connection) isSendClosed() bool {
+	return conn.isClosed() && !conn.stopping.Load()
+}
+
 func (conn *Connection) GetTCPConn() *net.TCPConn {
 	// 注: 不要写成递归调用
+	tcpConn, _ := conn.Conn.(*net.TCPConn)
+	return tcpConn
+}
+
+func (conn *Connection) GetNetConn() net.Conn {
 	return conn.Conn
 }
 
+func (conn *Connection) GetPeerCertificate() *x509.Certificate {
+	return peerCertificate(conn.Conn)
+}
+
+func (conn *Connection) GetIdentity() ziface.IIdentity {
+	return conn.identity.get()
+}
+
+func (conn *Connection) handshake() error {
+	tlsConn, ok := conn.Conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	// 握手超时后直接断开, 避免占用连接数
+	if err := tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout)); err != nil {
+		return err
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	return tlsConn.SetDeadline(time.Time{})
+}
+
 func (conn *Connection) GetConnID() uint32 {
 	return conn.ConnID
 }
@@ -76,80 +271,375 @@ func (conn *Connection) RemoteAddr() net.Addr {
 }
 
 func (conn *Connection) SendMessage(id uint32, data []byte) error {
-	// 1. 获取编解码器
-	codec := NewCodec()
-	// 2. 封装消息
-	message := NewMessage(id, data)
-	// 3. 编码
-	buf, err := codec.Encode(message)
+	return conn.sendMessage(NewMessage(id, data))
+}
+
+func (conn *Connection) SendMessageBlocking(ctx context.Context, id uint32, data []byte) error {
+	// 1. 编码
+	buf, err := conn.encode(NewMessage(id, data))
 	if err != nil {
-		fmt.Println("[zinx] send encode buf err", err)
 		return err
 	}
-	// 4. 发送数据
-	conn.MessageChan <- buf
-	return nil
+	// 2. 阻塞等待发送队列
+	return conn.enqueue(ctx, buf)
+}
+
+func (conn *Connection) SendHeartbeat() error {
+	return conn.SendMessage(conn.Server.GetConfig().ZinxHeartbeatID, []byte(HeartbeatPing))
+}
+
+func (conn *Connection) Reply(request ziface.IRequest, data []byte) error {
+	// 0. 每个请求最多回复一次: 处理超时或者已经回复之后, 丢弃处理器的回复
+	if err := claimReply(request); err != nil {
+		return err
+	}
+	// 1. 封装消息: 携带请求的序列号, 客户端根据序列号匹配响应
+	message := NewMessage(request.GetMessage().GetMessageID(), data)
+	message.SetRequestID(request.GetRequestID())
+	// 2. 发送消息
+	return conn.sendMessage(message)
+}
+
+// encode 压缩之后编码
+func (conn *Connection) encode(message ziface.IMessage) (*Buffer, error) {
+	message = compressMessage(conn.compression.get(), conn.compressionThreshold, message)
+	buf, err := encodeBuffer(conn.Codec, message)
+	if err != nil {
+		conn.Logger.Error("[zinx] send encode buf err", "message_id", message.GetMessageID(), "err", err)
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (conn *Connection) sendMessage(message ziface.IMessage) error {
+	// 1. 编码
+	buf, err := conn.encode(message)
+	if err != nil {
+		return err
+	}
+	// 2. 发送数据
+	if conn.SendQueuePolicy == SendQueuePolicyBlock {
+		return conn.enqueue(context.Background(), buf)
+	}
+	if conn.isSendClosed() {
+		PutBuffer(buf)
+		return ErrConnClosed
+	}
+	conn.queued.Add(1)
+	select {
+	case conn.MessageChan <- buf:
+		conn.wakeWriter()
+		if conn.isClosed() {
+			conn.stopSent.Store(true)
+		}
+		return nil
+	case <-conn.done:
+		conn.queued.Add(-1)
+		PutBuffer(buf)
+		return ErrConnClosed
+	default:
+	}
+	// 3. 发送队列已满
+	conn.queued.Add(-1)
+	PutBuffer(buf)
+	conn.Logger.Warn("[zinx] conn send queue full", "message_id", message.GetMessageID(), "policy", conn.SendQueuePolicy)
+	if conn.SendQueuePolicy == SendQueuePolicyDisconnect {
+		conn.stopAsync(ErrSendQueueFull)
+	}
+	return ErrSendQueueFull
+}
+
+func (conn *Connection) enqueue(ctx context.Context, buf *Buffer) error {
+	if conn.isSendClosed() {
+		PutBuffer(buf)
+		return ErrConnClosed
+	}
+	// 关闭的钩子函数执行期间写协程可能已经退出, 不能一直阻塞
+	if conn.isClosed() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, stopFlushTimeout)
+		defer cancel()
+	}
+	conn.queued.Add(1)
+	select {
+	case conn.MessageChan <- buf:
+		conn.wakeWriter()
+		if conn.isClosed() {
+			conn.stopSent.Store(true)
+		}
+		return nil
+	case <-conn.done:
+		conn.queued.Add(-1)
+		PutBuffer(buf)
+		return ErrConnClosed
+	case <-ctx.Done():
+		conn.queued.Add(-1)
+		PutBuffer(buf)
+		return ctx.Err()
+	}
 }
 
 func (conn *Connection) ReadConn() {
-	fmt.Println("Reader Goroutine is Running... ConnID", conn.ConnID)
-	// 1. 函数退出后释放资源
-	defer fmt.Println("Reader Goroutine is Exit... ConnID", conn.ConnID)
-	defer conn.StopConn()
+	conn.Logger.Debug("[zinx] reader goroutine is running")
+	defer conn.Logger.Debug("[zinx] reader goroutine is exit")
+	// 1. 读取结束后关闭连接: 读取的错误作为关闭的原因
+	conn.StopConnWithReason(conn.readMessages())
+}
+
+// readMessages 循环读取并处理消息, 直到读取出错或者连接关闭
+func (conn *Connection) readMessages() error {
+	// 2. 获取定长解码器: 头部缓冲区在整个连接中复用, 通过 bufio 减少系统调用
+	codec := conn.Codec
+	reader := bufio.NewReaderSize(conn.Conn, readBufferSize)
+	headBuf := make([]byte, codec.GetHeadLength())
+	deadline := false
 	for {
-		// 2. 获取定长解码器
-		codec := NewCodec()
-		// 3. 读取消息体的头信
-		headBuf := make([]byte, codec.GetHeadLength())
-		if _, err := io.ReadFull(conn.Conn, headBuf); err != nil {
-			fmt.Println("[zinx] read head buf err", err)
-			return
+		// 3. 读取消息体的头信: 每次读取前获取最新的配置, 支持热加载空闲超时时间
+		config := conn.Server.GetConfig()
+		if idleTimeout := time.Duration(config.ZinxIdleTimeout) * time.Second; idleTimeout > 0 || deadline {
+			var readDeadline time.Time
+			if idleTimeout > 0 {
+				readDeadline = time.Now().Add(idleTimeout)
+			}
+			if err := conn.Conn.SetReadDeadline(readDeadline); err != nil {
+				conn.Logger.Warn("[zinx] set read deadline err", "err", err)
+				return err
+			}
+			deadline = idleTimeout > 0
+		}
+		if n, err := io.ReadFull(reader, headBuf); err != nil {
+			// 3.1 没有读取到任何数据的超时属于空闲, 交给应用决定是否关闭连接
+			if n == 0 && isTimeout(err) {
+				conn.Server.GetOnConnIdle(conn)
+				if conn.isClosed() {
+					return ErrConnIdle
+				}
+				continue
+			}
+			conn.Logger.Debug("[zinx] read head buf err", "err", err)
+			return err
 		}
 		// 4. 解码器
 		message, err := codec.Decode(headBuf)
-		// TODO 暂时没有考虑接收到的消息序列号
-		if err != nil || message.GetMessageID() < 0 {
-			fmt.Println("[zinx] read decode head buf err", err)
-			return
+		if err != nil {
+			conn.Logger.Warn("[zinx] read decode head buf err", "err", err)
+			return err
 		}
-		// 5. 读取消息体
-		// TODO 暂时没有考虑解决半包问题
-		dataBuf := make([]byte, message.GetMessageLength())
-		if _, err := io.ReadFull(conn.Conn, dataBuf); err != nil {
-			fmt.Println("[zinx] read decode body buf err", err)
-			return
+		// 4.1 判断消息长度是否超过限制: 如果超过限制, 直接断开连接
+		if config.ZinxMaxPackage > 0 && message.GetMessageLength() > config.ZinxMaxPackage {
+			conn.Logger.Warn("[zinx] read decode head buf err", "message_id", message.GetMessageID(), "length", message.GetMessageLength(), "err", ErrPackageTooLarge)
+			return ErrPackageTooLarge
 		}
-		// 6. 向消息体中填充内容
-		message.SetMessageData(dataBuf)
-		// 7. 封装请求
-		req := Request{
-			Message: message,
-			Conn:    conn,
+		// 5. 读取消息体: 缓冲区来自缓冲池, 路由器处理完毕后放回
+		dataBuf := GetBuffer(int(message.GetMessageLength()))
+		if _, err := io.ReadFull(reader, dataBuf.B); err != nil {
+			PutBuffer(dataBuf)
+			conn.Logger.Warn("[zinx] read decode body buf err", "message_id", message.GetMessageID(), "err", err)
+			return err
 		}
-		// 4. 处理数据
-		conn.Router.SendMessageToTaskQueue(&req)
+		// 6. 向消息体中填充内容, 交给路由器处理
+		attachBuffer(message, dataBuf)
+		if !conn.handleMessage(config, message) {
+			return ErrConnClosed
+		}
+	}
+}
+
+// decodeMessages 事件循环模式: 处理 data 中所有完整的消息, 返回已经处理的字节数
+func (conn *Connection) decodeMessages(data []byte) (int, error) {
+	config := conn.Server.GetConfig()
+	headLength := int(conn.Codec.GetHeadLength())
+	consumed := 0
+	for len(data)-consumed >= headLength {
+		// 1. 解码头部
+		message, err := conn.Codec.Decode(data[consumed : consumed+headLength])
+		if err != nil {
+			return consumed, err
+		}
+		// 2. 判断消息长度是否超过限制: 如果超过限制, 直接断开连接
+		if config.ZinxMaxPackage > 0 && message.GetMessageLength() > config.ZinxMaxPackage {
+			return consumed, ErrPackageTooLarge
+		}
+		// 3. 消息体还没有完整到达, 等待下一次读取
+		end := consumed + headLength + int(message.GetMessageLength())
+		if end > len(data) {
+			break
+		}
+		// 4. 消息体复制到缓冲池中, 读缓冲区会被下一次读取覆盖
+		dataBuf := GetBuffer(int(message.GetMessageLength()))
+		copy(dataBuf.B, data[consumed+headLength:end])
+		consumed = end
+		attachBuffer(message, dataBuf)
+		if !conn.handleMessage(config, message) {
+			return consumed, ErrConnClosed
+		}
+	}
+	return consumed, nil
+}
+
+// handleMessage 处理一条完整的消息, 读协程和事件循环共用; 返回 false 表示连接已经关闭
+func (conn *Connection) handleMessage(config *utils.Configuration, message ziface.IMessage) bool {
+	conn.Server.GetMetrics().RecordRead(int(conn.Codec.GetHeadLength()) + len(message.GetMessageData()))
+	// 0. 压缩协商消息直接处理; 压缩的消息先解压, 解压后的长度同样受到消息长度的限制
+	if conn.negotiateCompression(config, message) {
+		releaseMessage(message)
+		return true
+	}
+	if err := decompressMessage(conn.compression.get(), config.ZinxMaxPackage, message); err != nil {
+		conn.Logger.Warn("[zinx] decompress message err", "message_id", message.GetMessageID(), "err", err)
+		releaseMessage(message)
+		conn.stopAsync(err)
+		return false
+	}
+	// 1. 心跳消息直接处理, 不交给路由器
+	if handleHeartbeat(config.ZinxHeartbeatID, conn, message) {
+		releaseMessage(message)
+		return true
+	}
+	// 1.1 认证阶段: 消息交给认证器处理, 不交给路由器
+	if conn.authenticate(config, message) {
+		releaseMessage(message)
+		return !conn.isClosed()
+	}
+	// 2. 限流: 超过限制时按照配置丢弃消息, 暂停读取或者断开连接
+	if !conn.rateLimit(config, message) {
+		releaseMessage(message)
+		return !conn.isClosed()
 	}
+	// 3. 封装请求: 配置了处理超时的消息开始计时
+	req := newRequest(conn, config, message)
+	// 4. 处理数据
+	conn.Router.SendMessageToTaskQueue(req)
+	return true
 }
 
 func (conn *Connection) WriteConn() {
-	fmt.Println("Writer Goroutine is Running... ConnID", conn.ConnID)
-	defer fmt.Println("Writer Goroutine is Exit... ConnID", conn.ConnID)
+	conn.Logger.Debug("[zinx] writer goroutine is running")
+	defer conn.Logger.Debug("[zinx] writer goroutine is exit")
+	writer := newBatchWriter(conn.Conn, conn.WriteBatchSize)
 	// 1. 循环阻塞读取读通道交付的数据
 	for {
 		select {
-		// 2. 如果收到通道中的消息, 那么就转发个客户端
+		// 2. 如果收到通道中的消息, 那么合并发送队列中的其他消息后一次写入
 		case data := <-conn.MessageChan:
-			if _, err := conn.Conn.Write(data); err != nil {
-				fmt.Println("[zinx] send buf err")
+			if err := conn.writeBatch(writer, data); err != nil {
+				conn.Logger.Warn("[zinx] send buf err", "err", err)
+				conn.writeFailed.Store(true)
+				conn.StopConnWithReason(err)
 				return
 			}
 		// 3. 如果收到关闭消息, 那么就直接退出
-		case <-conn.ExitChan:
+		case <-conn.done:
 			return
 		}
 	}
 }
 
+// wakeWriter 事件循环模式下没有常驻的写协程: 消息加入发送队列后启动写协程, 队列清空后写协程退出
+func (conn *Connection) wakeWriter() {
+	if conn.poller == nil || !conn.writing.CompareAndSwap(false, true) {
+		return
+	}
+	go conn.flushQueue()
+}
+
+// flushQueue 写入发送队列中的所有消息后退出
+func (conn *Connection) flushQueue() {
+	writer := newBatchWriter(conn.Conn, conn.WriteBatchSize)
+	for {
+		select {
+		case data := <-conn.MessageChan:
+			if err := conn.writeBatch(writer, data); err != nil {
+				// 写入失败后不再启动写协程
+				conn.Logger.Warn("[zinx] send buf err", "err", err)
+				conn.writeFailed.Store(true)
+				conn.StopConnWithReason(err)
+				return
+			}
+			continue
+		default:
+		}
+		// 队列为空: 退出前再次检查, 避免遗漏退出过程中加入队列的消息
+		conn.writing.Store(false)
+		if len(conn.MessageChan) == 0 || !conn.writing.CompareAndSwap(false, true) {
+			return
+		}
+	}
+}
+
+// writeBatch 合并发送队列中的其他消息后一次写入, 写入后缓冲区放回缓冲池
+func (conn *Connection) writeBatch(writer *batchWriter, data *Buffer) error {
+	batch := conn.collectBatch(append(writer.batch[:0], data))
+	err := writer.write(batch)
+	for index, data := range batch {
+		conn.Server.GetMetrics().RecordWrite(len(data.B))
+		PutBuffer(data)
+		batch[index] = nil
+	}
+	conn.queued.Add(-int32(len(batch)))
+	writer.batch = batch
+	return err
+}
+
+// waitFlushed 等待发送队列中的消息全部写入, 直到 ctx 结束, 连接关闭或者写入失败
+func (conn *Connection) waitFlushed(ctx context.Context) {
+	for conn.queued.Load() > 0 && !conn.writeFailed.Load() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-conn.done:
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// flushOnStop 关闭连接之前等待钩子函数发送的消息写入, 最多等待 stopFlushTimeout; 钩子函数没有发送消息时直接关闭
+func (conn *Connection) flushOnStop() {
+	if !conn.stopSent.Load() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stopFlushTimeout)
+	defer cancel()
+	conn.waitFlushed(ctx)
+}
+
+// collectBatch 从发送队列中继续取出消息, 直到达到批量大小, 队列为空并且超过等待时间
+func (conn *Connection) collectBatch(batch []*Buffer) []*Buffer {
+	var timeout <-chan time.Time
+	if conn.WriteFlushInterval > 0 {
+		timer := time.NewTimer(conn.WriteFlushInterval)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for len(batch) < conn.WriteBatchSize {
+		// 1. 优先取出已经在队列中的消息
+		select {
+		case data := <-conn.MessageChan:
+			batch = append(batch, data)
+			continue
+		default:
+		}
+		// 2. 队列为空时在等待时间内继续等待新的消息
+		if timeout == nil {
+			return batch
+		}
+		select {
+		case data := <-conn.MessageChan:
+			batch = append(batch, data)
+		case <-timeout:
+			return batch
+		case <-conn.done:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (conn *Connection) GetLogger() ziface.ILogger {
+	return conn.Logger
+}
+
 func (conn *Connection) SetConnectionProperty(key string, value interface{}) {
 	conn.propertyLock.Lock()
 	defer conn.propertyLock.Unlock()
@@ -161,7 +651,7 @@ func (conn *Connection) GetConnectionProperty(key string) (value interface{}) {
 	defer conn.propertyLock.RUnlock()
 	result, ok := conn.properties[key]
 	if !ok {
-		fmt.Println("[zinx] get property doesn't exit")
+		conn.Logger.Debug("[zinx] get property doesn't exit", "key", key)
 		return nil
 	}
 	return result
@@ -172,25 +662,46 @@ func (conn *Connection) RemoveConnectionProperty(key string) {
 	defer conn.propertyLock.Unlock()
 	_, ok := conn.properties[key]
 	if !ok {
-		fmt.Println("[zinx] remove property doesn't exit")
+		conn.Logger.Debug("[zinx] remove property doesn't exit", "key", key)
 		return
 	}
 	delete(conn.properties, key)
 }
 
-func NewConn(connID uint32, conn *net.TCPConn, router ziface.IRouter, server ziface.IServer) *Connection {
+func NewConn(connID uint32, conn net.Conn, router ziface.IRouter, server ziface.IServer) *Connection {
 	// 1. 创建连接
 	connection := &Connection{
-		ConnID:      connID,
-		Conn:        conn,
-		isClosed:    false,
-		Router:      router,
-		ExitChan:    make(chan bool, 1),
-		MessageChan: make(chan []byte),
-		Server:      server,
+		ConnID:               connID,
+		Conn:                 conn,
+		Router:               router,
+		Codec:                server.GetCodec(),
+		done:                 make(chan struct{}),
+		MessageChan:          make(chan *Buffer, server.GetConfig().ZinxSendQueueSize),
+		SendQueuePolicy:      server.GetConfig().ZinxSendQueuePolicy,
+		WriteBatchSize:       int(server.GetConfig().ZinxWriteBatchSize),
+		WriteFlushInterval:   time.Duration(server.GetConfig().ZinxWriteFlushInterval) * time.Microsecond,
+		Server:               server,
+		Logger:               server.GetLogger().With("conn_id", connID, "remote_addr", conn.RemoteAddr().String()),
+		rateLimiter:          newRateLimiter(server.GetConfig().ZinxConnRateLimit, server.GetConfig().ZinxConnRateBurst),
+		messageRateLimiters:  make(map[uint32]*TokenBucket),
+		properties:           make(map[string]interface{}),
+		compressionThreshold: server.GetConfig().ZinxCompressionThreshold,
+		authenticator:        server.GetAuthenticator(),
+	}
+	// 1.1 不协商压缩时所有连接直接压缩
+	if config := server.GetConfig(); config.ZinxCompressionID == 0 {
+		connection.compression.set(GetCompressor(config.ZinxCompression))
+	}
+	// 1.2 每次至少写入一条消息
+	if connection.WriteBatchSize < 1 {
+		connection.WriteBatchSize = 1
 	}
+	// 1.3 连接的上下文: 关闭连接时取消
+	connection.ctx, connection.cancel = context.WithCancelCause(context.Background())
+	// 1.4 开始认证阶段计时: 包括 TLS 握手的时间
+	connection.startAuth(server.GetConfig())
 	// 2. 添加连接
 	connection.Server.GetConnManager().AddConnection(connection)
-	fmt.Println("now ", connection.Server.GetConnManager().GetConnectionCount(), "limit ", utils.Config.ZinxMaxConn)
+	connection.Logger.Debug("[zinx] conn add", "count", connection.Server.GetConnManager().GetConnectionCount(), "limit", server.GetConfig().ZinxMaxConn)
 	return connection
 }
@@ -0,0 +1,506 @@
+package znet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 以下测试需要通过 go test -race 运行, 检查连接生命周期中的数据竞争
+
+// newTestServer 创建不监听端口的服务器, 连接通过 net.Pipe 建立
+func newTestServer(t *testing.T, options ...Option) *Server {
+	t.Helper()
+	options = append([]Option{WithLogger(zlog.NewNopLogger())}, options...)
+	server, err := NewServer(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server.(*Server)
+}
+
+// newTestConn 创建连接, 对端持续读取并丢弃数据, 避免写协程阻塞
+func newTestConn(server *Server, connID uint32) (*Connection, net.Conn) {
+	local, peer := net.Pipe()
+	go func() {
+		_, _ = io.Copy(io.Discard, peer)
+	}()
+	return NewConn(connID, local, server.Router, server), peer
+}
+
+// newPeerConn 创建连接, 对端由测试读取
+func newPeerConn(server *Server, connID uint32) (*Connection, net.Conn) {
+	local, peer := net.Pipe()
+	return NewConn(connID, local, server.Router, server), peer
+}
+
+// writeFrame 对端按照默认编解码器发送一帧
+func writeFrame(t *testing.T, peer net.Conn, id uint32, data []byte) {
+	t.Helper()
+	buf, _ := NewCodec().Encode(NewMessage(id, data))
+	if _, err := peer.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrame 对端按照默认编解码器读取一帧
+func readFrame(t *testing.T, peer net.Conn) (uint32, []byte) {
+	t.Helper()
+	_ = peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	head := make([]byte, NewCodec().GetHeadLength())
+	if _, err := io.ReadFull(peer, head); err != nil {
+		t.Fatalf("read head err = %v", err)
+	}
+	message, _ := NewCodec().Decode(head)
+	data := make([]byte, message.GetMessageLength())
+	if _, err := io.ReadFull(peer, data); err != nil {
+		t.Fatalf("read data err = %v", err)
+	}
+	return message.GetMessageID(), data
+}
+
+// testHandler 使用函数实现处理器
+type testHandler struct {
+	BaseHandler
+	handle func(request ziface.IRequest)
+}
+
+func (handler *testHandler) Handle(request ziface.IRequest) {
+	handler.handle(request)
+}
+
+func waitDone(t *testing.T, conn ziface.IConnection) {
+	t.Helper()
+	select {
+	case <-conn.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("conn %d not closed, state = %s", conn.GetConnID(), conn.GetState())
+	}
+}
+
+func TestConnStateTransitions(t *testing.T) {
+	server := newTestServer(t)
+	var startState, stopState ziface.ConnState
+	var stopReason error
+	server.SetOnConnStart(func(connection ziface.IConnection) {
+		startState = connection.GetState()
+	})
+	server.SetOnConnStop(func(connection ziface.IConnection) {
+		stopState = connection.GetState()
+		stopReason = connection.GetCloseReason()
+	})
+	conn, _ := newTestConn(server, 1)
+	if conn.GetState() != ziface.ConnStateConnecting || conn.GetCloseReason() != nil {
+		t.Fatalf("new conn state = %s, reason = %v", conn.GetState(), conn.GetCloseReason())
+	}
+	conn.StartConn()
+	if startState != ziface.ConnStateActive {
+		t.Fatalf("OnConnStart state = %s", startState)
+	}
+	conn.StopConnWithReason(ErrConnKicked)
+	waitDone(t, conn)
+	if conn.GetState() != ziface.ConnStateClosed {
+		t.Fatalf("stopped conn state = %s", conn.GetState())
+	}
+	if stopState != ziface.ConnStateClosing || !errors.Is(stopReason, ErrConnKicked) {
+		t.Fatalf("OnConnStop state = %s, reason = %v", stopState, stopReason)
+	}
+	// 第二次关闭不会覆盖原因
+	conn.StopConn()
+	if !errors.Is(conn.GetCloseReason(), ErrConnKicked) {
+		t.Fatalf("reason overwritten: %v", conn.GetCloseReason())
+	}
+	if err := conn.SendMessage(1, []byte("late")); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("send after stop err = %v", err)
+	}
+}
+
+func TestConnStopBeforeStart(t *testing.T) {
+	server := newTestServer(t)
+	var started atomic.Bool
+	server.SetOnConnStart(func(connection ziface.IConnection) {
+		started.Store(true)
+	})
+	conn, _ := newTestConn(server, 1)
+	conn.StopConnWithReason(ErrServerStopped)
+	conn.StartConn()
+	if started.Load() || conn.GetState() != ziface.ConnStateClosed {
+		t.Fatalf("closed conn started, state = %s", conn.GetState())
+	}
+}
+
+func TestConnReadCloseReason(t *testing.T) {
+	server := newTestServer(t)
+	conn, peer := newTestConn(server, 1)
+	conn.StartConn()
+	_ = peer.Close()
+	waitDone(t, conn)
+	if reason := conn.GetCloseReason(); !errors.Is(reason, io.EOF) && !errors.Is(reason, io.ErrClosedPipe) {
+		t.Fatalf("reason = %v", reason)
+	}
+}
+
+func TestConnConcurrentStop(t *testing.T) {
+	server := newTestServer(t)
+	var stops atomic.Int32
+	server.SetOnConnStop(func(connection ziface.IConnection) {
+		stops.Add(1)
+	})
+	conn, peer := newTestConn(server, 1)
+	conn.StartConn()
+	// 读协程 (对端关闭), 连接管理器和应用同时关闭连接
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			switch i % 4 {
+			case 0:
+				_ = peer.Close()
+			case 1:
+				server.GetConnManager().CloseConnections()
+			default:
+				conn.StopConn()
+			}
+		}(i)
+	}
+	wg.Wait()
+	waitDone(t, conn)
+	if stops.Load() != 1 {
+		t.Fatalf("OnConnStop called %d times", stops.Load())
+	}
+	if count := server.GetConnManager().GetConnectionCount(); count != 0 {
+		t.Fatalf("connection count = %d", count)
+	}
+}
+
+func TestConnConcurrentSendAndStop(t *testing.T) {
+	config := utils.NewConfiguration()
+	config.ZinxSendQueueSize = 4
+	server := newTestServer(t, WithConfig(config))
+	conn, _ := newTestConn(server, 1)
+	conn.StartConn()
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				err := conn.SendMessage(1, []byte("ping"))
+				if err != nil && !errors.Is(err, ErrConnClosed) && !errors.Is(err, ErrSendQueueFull) {
+					t.Errorf("send err = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	// 阻塞发送在连接关闭后返回
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			err := conn.SendMessageBlocking(context.Background(), 1, []byte("ping"))
+			if errors.Is(err, ErrConnClosed) {
+				return
+			}
+		}
+	}()
+	time.Sleep(time.Millisecond)
+	conn.StopConn()
+	wg.Wait()
+	waitDone(t, conn)
+}
+
+func TestCloseConnectionsConcurrent(t *testing.T) {
+	server := newTestServer(t)
+	var stops atomic.Int32
+	server.SetOnConnStop(func(connection ziface.IConnection) {
+		if !errors.Is(connection.GetCloseReason(), ErrServerStopped) && !errors.Is(connection.GetCloseReason(), ErrConnStopped) {
+			t.Errorf("conn %d reason = %v", connection.GetConnID(), connection.GetCloseReason())
+		}
+		stops.Add(1)
+	})
+	conns := make([]*Connection, 64)
+	for i := range conns {
+		conns[i], _ = newTestConn(server, uint32(i+1))
+		conns[i].StartConn()
+	}
+	// 关闭所有连接的同时广播, 统计连接数量, 单独关闭连接
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		server.GetConnManager().CloseConnections()
+	}()
+	go func() {
+		defer wg.Done()
+		server.GetConnManager().Broadcast(1, []byte("bye"))
+		_ = server.GetConnManager().GetConnectionCount()
+	}()
+	go func() {
+		defer wg.Done()
+		for _, conn := range conns[:len(conns)/2] {
+			conn.StopConn()
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("CloseConnections deadlock")
+	}
+	for _, conn := range conns {
+		waitDone(t, conn)
+	}
+	if stops.Load() != int32(len(conns)) {
+		t.Fatalf("OnConnStop called %d times, want %d", stops.Load(), len(conns))
+	}
+	if count := server.GetConnManager().GetConnectionCount(); count != 0 {
+		t.Fatalf("connection count = %d", count)
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	config := utils.NewConfiguration()
+	config.ZinxHandlerTimeouts = map[uint32]uint32{1: 10}
+	server := newTestServer(t, WithConfig(config))
+	timeouts := make(chan ziface.IRequest, 1)
+	server.SetOnHandlerTimeout(func(request ziface.IRequest) {
+		timeouts <- request
+	})
+	conn, _ := newTestConn(server, 1)
+	conn.StartConn()
+	// 1. 超时后取消请求的上下文, 执行钩子函数, 丢弃处理器的回复
+	request := newRequest(conn, config, NewMessage(1, nil))
+	select {
+	case timedOut := <-timeouts:
+		if timedOut != request {
+			t.Fatal("hook received another request")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler timeout hook not called")
+	}
+	if !errors.Is(request.Context().Err(), context.DeadlineExceeded) {
+		t.Fatalf("request ctx err = %v", request.Context().Err())
+	}
+	if err := conn.Reply(request, []byte("late")); !errors.Is(err, ErrHandlerTimeout) {
+		t.Fatalf("late reply err = %v", err)
+	}
+	releaseRequest(request)
+	// 2. 没有配置超时的请求在连接关闭时取消, 不执行钩子函数
+	request = newRequest(conn, config, NewMessage(2, nil))
+	conn.StopConnWithReason(ErrConnKicked)
+	<-request.Context().Done()
+	if cause := context.Cause(request.Context()); !errors.Is(cause, ErrConnKicked) {
+		t.Fatalf("request ctx cause = %v", cause)
+	}
+	select {
+	case <-timeouts:
+		t.Fatal("handler timeout hook called after conn closed")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// networkModes 当前平台支持的网络模型
+func networkModes() []string {
+	if runtime.GOOS == "linux" {
+		return []string{NetworkModeGoroutine, NetworkModeEpoll}
+	}
+	return []string{NetworkModeGoroutine}
+}
+
+func TestConnLifecycleNetworkModes(t *testing.T) {
+	for _, mode := range networkModes() {
+		t.Run(mode, func(t *testing.T) {
+			config := utils.NewConfiguration()
+			config.ZinxNetworkMode = mode
+			config.ZinxEventLoops = 2
+			server := newTestServer(t, WithConfig(config))
+			starts := make(chan ziface.ConnState, 4)
+			stops := make(chan error, 4)
+			server.SetOnConnStart(func(connection ziface.IConnection) {
+				starts <- connection.GetState()
+			})
+			server.SetOnConnStop(func(connection ziface.IConnection) {
+				stops <- connection.GetCloseReason()
+			})
+			server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+				_ = request.GetConn().Reply(request, request.GetMessage().GetMessageData())
+			}})
+			address := startTestServer(t, server)
+			// 1. 建立连接, 回显消息
+			client, err := net.Dial("tcp", address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state := <-starts; state != ziface.ConnStateActive {
+				t.Fatalf("OnConnStart state = %s", state)
+			}
+			for _, data := range []string{"ping", "pong"} {
+				writeFrame(t, client, 1, []byte(data))
+				if id, reply := readFrame(t, client); id != 1 || string(reply) != data {
+					t.Fatalf("reply = %d %q", id, reply)
+				}
+			}
+			// 2. 对端关闭, 关闭原因为读取的错误
+			_ = client.Close()
+			select {
+			case reason := <-stops:
+				if !errors.Is(reason, io.EOF) && !errors.Is(reason, syscall.ECONNRESET) {
+					t.Fatalf("peer close reason = %v", reason)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("OnConnStop not called after peer close")
+			}
+			// 3. 停止服务器关闭剩余的连接
+			client, err = net.Dial("tcp", address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			<-starts
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := server.Stop(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if reason := <-stops; !errors.Is(reason, ErrServerStopped) {
+				t.Fatalf("stop reason = %v", reason)
+			}
+			_ = client.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := client.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+				t.Fatalf("client read after stop err = %v", err)
+			}
+			if count := server.GetConnManager().GetConnectionCount(); count != 0 {
+				t.Fatalf("connection count = %d", count)
+			}
+		})
+	}
+}
+
+func TestConnStopHookSend(t *testing.T) {
+	for _, mode := range networkModes() {
+		t.Run(mode, func(t *testing.T) {
+			config := utils.NewConfiguration()
+			config.ZinxNetworkMode = mode
+			config.ZinxEventLoops = 2
+			server := newTestServer(t, WithConfig(config))
+			starts := make(chan ziface.IConnection, 1)
+			sends := make(chan error, 2)
+			server.SetOnConnStart(func(connection ziface.IConnection) {
+				starts <- connection
+			})
+			// 关闭的钩子函数中发送消息: 关闭连接之前写入
+			server.SetOnConnStop(func(connection ziface.IConnection) {
+				sends <- connection.SendMessage(2, []byte("bye"))
+				sends <- connection.SendMessageBlocking(context.Background(), 3, []byte(connection.GetCloseReason().Error()))
+			})
+			address := startTestServer(t, server)
+			client, err := net.Dial("tcp", address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			(<-starts).StopConnWithReason(ErrConnKicked)
+			for i := 0; i < 2; i++ {
+				if err := <-sends; err != nil {
+					t.Fatalf("send in OnConnStop err = %v", err)
+				}
+			}
+			if id, data := readFrame(t, client); id != 2 || string(data) != "bye" {
+				t.Fatalf("farewell = %d %q", id, data)
+			}
+			if id, data := readFrame(t, client); id != 3 || string(data) != ErrConnKicked.Error() {
+				t.Fatalf("reason frame = %d %q", id, data)
+			}
+			if _, err := client.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+				t.Fatalf("client read after farewell err = %v", err)
+			}
+		})
+	}
+}
+
+func TestConnStopHookSendAfterPeerClose(t *testing.T) {
+	server := newTestServer(t)
+	server.SetOnConnStop(func(connection ziface.IConnection) {
+		_ = connection.SendMessage(2, []byte("bye"))
+	})
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	// 对端已经关闭: 写入失败后直接关闭连接, 不等待 stopFlushTimeout
+	start := time.Now()
+	_ = peer.Close()
+	waitDone(t, conn)
+	if elapsed := time.Since(start); elapsed >= stopFlushTimeout/2 {
+		t.Fatalf("stop took %v", elapsed)
+	}
+	if err := conn.SendMessage(1, []byte("late")); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("send after stop err = %v", err)
+	}
+}
+
+func TestEventLoopStopHookNotBlocking(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("event loop requires linux")
+	}
+	config := utils.NewConfiguration()
+	config.ZinxNetworkMode = NetworkModeEpoll
+	config.ZinxEventLoops = 1
+	server := newTestServer(t, WithConfig(config))
+	starts := make(chan struct{}, 2)
+	stopping := make(chan struct{})
+	release := make(chan struct{})
+	var blockOnce sync.Once
+	server.SetOnConnStart(func(connection ziface.IConnection) {
+		starts <- struct{}{}
+	})
+	// 第一个关闭的连接阻塞在钩子函数中
+	server.SetOnConnStop(func(connection ziface.IConnection) {
+		blockOnce.Do(func() {
+			close(stopping)
+			<-release
+		})
+	})
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		_ = request.GetConn().Reply(request, request.GetMessage().GetMessageData())
+	}})
+	address := startTestServer(t, server)
+	defer close(release)
+	// 1. 两个连接使用同一个事件循环
+	clients := make([]net.Conn, 2)
+	for index := range clients {
+		client, err := net.Dial("tcp", address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		clients[index] = client
+		<-starts
+	}
+	// 2. 第一个连接的对端关闭, 关闭的钩子函数阻塞
+	_ = clients[0].Close()
+	select {
+	case <-stopping:
+	case <-time.After(time.Second):
+		t.Fatal("OnConnStop not called after peer close")
+	}
+	// 3. 事件循环没有被阻塞, 第二个连接仍然可以收发
+	writeFrame(t, clients[1], 1, []byte("ping"))
+	if id, data := readFrame(t, clients[1]); id != 1 || string(data) != "ping" {
+		t.Fatalf("reply = %d %q", id, data)
+	}
+}
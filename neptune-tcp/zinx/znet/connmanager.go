@@ -2,20 +2,49 @@ package znet
 
 import (
 	"errors"
-	"fmt"
+	"neptune-golang/neptune-tcp/zinx/utils"
 	"neptune-golang/neptune-tcp/zinx/ziface"
+	"neptune-golang/neptune-tcp/zinx/zlog"
 	"sync"
 )
 
+// 同一个用户重复登录时的策略, 定义在配置中
+const (
+	DuplicateLoginAllow  = utils.DuplicateLoginAllow
+	DuplicateLoginKick   = utils.DuplicateLoginKick
+	DuplicateLoginReject = utils.DuplicateLoginReject
+)
+
+var ErrDuplicateLogin = errors.New("[zinx] user already logged in")
+
 type ConnManager struct {
 	// 注: 不对外提供的连接集合
 	connections map[uint32]ziface.IConnection
-	connLock    sync.RWMutex
+	// 分组: 分组名称 -> 连接集合
+	groups map[string]map[uint32]ziface.IConnection
+	// 连接加入的分组: 连接 ID -> 分组名称集合, 关闭连接时用于离开所有分组
+	connGroups map[uint32]map[string]struct{}
+	// 用户: 用户 ID -> 连接集合, 连接 ID -> 用户 ID
+	users     map[string]map[uint32]ziface.IConnection
+	connUsers map[uint32]string
+	// 重复登录策略
+	duplicateLogin string
+	connLock       sync.RWMutex
+	// 踢出连接的钩子函数
+	onKick func(oldConnection ziface.IConnection, newConnection ziface.IConnection)
+	// 日志
+	logger ziface.ILogger
 }
 
 func NewConnManager() ziface.IConnManager {
 	return &ConnManager{
-		connections: make(map[uint32]ziface.IConnection),
+		connections:    make(map[uint32]ziface.IConnection),
+		groups:         make(map[string]map[uint32]ziface.IConnection),
+		connGroups:     make(map[uint32]map[string]struct{}),
+		users:          make(map[string]map[uint32]ziface.IConnection),
+		connUsers:      make(map[uint32]string),
+		duplicateLogin: DuplicateLoginAllow,
+		logger:         zlog.Default(),
 	}
 }
 
@@ -25,11 +54,11 @@ func (conn *ConnManager) AddConnection(connection ziface.IConnection) {
 	defer conn.connLock.Unlock()
 	// 2. 添加到集合中
 	if _, result := conn.connections[connection.GetConnID()]; result {
-		fmt.Println("[zinx] conn already exit, can't add this conn")
+		conn.logger.Warn("[zinx] conn already exit, can't add this conn", "conn_id", connection.GetConnID())
 		return
 	}
 	conn.connections[connection.GetConnID()] = connection
-	fmt.Println("[zinx] conn add to connections success, count", conn.GetConnectionCount())
+	conn.logger.Debug("[zinx] conn add to connections success", "conn_id", connection.GetConnID(), "count", len(conn.connections))
 }
 
 func (conn *ConnManager) GetConnection(connID uint32) (connection ziface.IConnection, err error) {
@@ -37,7 +66,6 @@ func (conn *ConnManager) GetConnection(connID uint32) (connection ziface.IConnec
 	defer conn.connLock.RUnlock()
 	result, ok := conn.connections[connID]
 	if !ok {
-		fmt.Println("[zinx] conn doesn't exit")
 		return nil, errors.New("[zinx] conn doesn't exit")
 	}
 	return result, nil
@@ -49,26 +77,269 @@ func (conn *ConnManager) CloseConnection(connection ziface.IConnection) {
 	defer conn.connLock.Unlock()
 	// 2. 检验是否存在
 	if _, result := conn.connections[connection.GetConnID()]; !result {
-		fmt.Println("[zinx] conn doesn't exit, can't close this conn")
+		conn.logger.Debug("[zinx] conn doesn't exit, can't close this conn", "conn_id", connection.GetConnID())
 		return
 	}
 	// 3. 删除
 	delete(conn.connections, connection.GetConnID())
-	fmt.Println("[zinx] conn close in connection success, count ", conn.GetConnectionCount())
+	conn.leaveGroups(connection.GetConnID())
+	conn.unbindUser(connection.GetConnID())
+	conn.logger.Debug("[zinx] conn close in connection success", "conn_id", connection.GetConnID(), "count", len(conn.connections))
 }
 
 func (conn *ConnManager) GetConnectionCount() (count uint32) {
+	conn.connLock.RLock()
+	defer conn.connLock.RUnlock()
 	return uint32(len(conn.connections))
 }
 
+func (conn *ConnManager) GetConnections() []ziface.IConnection {
+	conn.connLock.RLock()
+	defer conn.connLock.RUnlock()
+	connections := make([]ziface.IConnection, 0, len(conn.connections))
+	for _, connection := range conn.connections {
+		connections = append(connections, connection)
+	}
+	return connections
+}
+
 func (conn *ConnManager) CloseConnections() {
+	// 1. 取出所有连接: 关闭连接时会回调 CloseConnection, 不能在持有锁的时候关闭
 	conn.connLock.Lock()
-	defer conn.connLock.Unlock()
+	connections := make([]ziface.IConnection, 0, len(conn.connections))
 	for connID, connection := range conn.connections {
-		// 删除
 		delete(conn.connections, connID)
-		// 关闭
-		connection.StopConn()
-		fmt.Println("[zinx] conn ", connID, " close in connection success")
+		conn.leaveGroups(connID)
+		conn.unbindUser(connID)
+		connections = append(connections, connection)
+	}
+	conn.connLock.Unlock()
+	// 2. 关闭
+	for _, connection := range connections {
+		connection.StopConnWithReason(ErrServerStopped)
+		conn.logger.Debug("[zinx] conn close in connection success", "conn_id", connection.GetConnID())
+	}
+}
+
+func (conn *ConnManager) SetLogger(logger ziface.ILogger) {
+	conn.logger = logger
+}
+
+func (conn *ConnManager) Broadcast(id uint32, data []byte) {
+	conn.BroadcastFilter(id, data, nil)
+}
+
+func (conn *ConnManager) BroadcastFilter(id uint32, data []byte, filter func(connection ziface.IConnection) bool) {
+	// 1. 取出所有连接: 发送失败时可能关闭连接, 不能在持有锁的时候发送
+	conn.connLock.RLock()
+	connections := make([]ziface.IConnection, 0, len(conn.connections))
+	for _, connection := range conn.connections {
+		connections = append(connections, connection)
+	}
+	conn.connLock.RUnlock()
+	// 2. 发送
+	for _, connection := range connections {
+		if filter != nil && !filter(connection) {
+			continue
+		}
+		if err := connection.SendMessage(id, data); err != nil {
+			connection.GetLogger().Warn("[zinx] broadcast to conn err", "message_id", id, "err", err)
+		}
+	}
+}
+
+func (conn *ConnManager) JoinGroup(group string, connection ziface.IConnection) error {
+	conn.connLock.Lock()
+	defer conn.connLock.Unlock()
+	// 1. 检验连接是否存在: 已经关闭的连接不能加入分组
+	if _, result := conn.connections[connection.GetConnID()]; !result {
+		return errors.New("[zinx] conn doesn't exit, can't join group")
+	}
+	// 2. 加入分组
+	if _, result := conn.groups[group]; !result {
+		conn.groups[group] = make(map[uint32]ziface.IConnection)
+	}
+	conn.groups[group][connection.GetConnID()] = connection
+	// 3. 记录连接加入的分组
+	if _, result := conn.connGroups[connection.GetConnID()]; !result {
+		conn.connGroups[connection.GetConnID()] = make(map[string]struct{})
+	}
+	conn.connGroups[connection.GetConnID()][group] = struct{}{}
+	return nil
+}
+
+func (conn *ConnManager) LeaveGroup(group string, connection ziface.IConnection) {
+	conn.connLock.Lock()
+	defer conn.connLock.Unlock()
+	conn.leaveGroup(group, connection.GetConnID())
+}
+
+func (conn *ConnManager) SendToGroup(group string, id uint32, data []byte) error {
+	// 1. 检验分组是否存在
+	connections := conn.GetGroupConnections(group)
+	if len(connections) == 0 {
+		return errors.New("[zinx] group doesn't exit")
+	}
+	// 2. 发送
+	for _, connection := range connections {
+		if err := connection.SendMessage(id, data); err != nil {
+			connection.GetLogger().Warn("[zinx] send to group err", "group", group, "message_id", id, "err", err)
+		}
+	}
+	return nil
+}
+
+func (conn *ConnManager) GetGroupConnections(group string) []ziface.IConnection {
+	conn.connLock.RLock()
+	defer conn.connLock.RUnlock()
+	connections := make([]ziface.IConnection, 0, len(conn.groups[group]))
+	for _, connection := range conn.groups[group] {
+		connections = append(connections, connection)
+	}
+	return connections
+}
+
+// leaveGroups 连接离开所有分组, 调用方需要持有锁
+func (conn *ConnManager) leaveGroups(connID uint32) {
+	for group := range conn.connGroups[connID] {
+		conn.leaveGroup(group, connID)
+	}
+}
+
+// leaveGroup 连接离开分组, 调用方需要持有锁
+func (conn *ConnManager) leaveGroup(group string, connID uint32) {
+	// 1. 从分组中移除连接, 分组为空时删除分组
+	if connections, result := conn.groups[group]; result {
+		delete(connections, connID)
+		if len(connections) == 0 {
+			delete(conn.groups, group)
+		}
+	}
+	// 2. 移除连接加入的分组记录
+	if groups, result := conn.connGroups[connID]; result {
+		delete(groups, group)
+		if len(groups) == 0 {
+			delete(conn.connGroups, connID)
+		}
+	}
+}
+
+func (conn *ConnManager) BindUser(userID string, connection ziface.IConnection) error {
+	// 1. 上锁
+	conn.connLock.Lock()
+	// 2. 检验连接是否存在: 已经关闭的连接不能绑定用户
+	if _, result := conn.connections[connection.GetConnID()]; !result {
+		conn.connLock.Unlock()
+		return errors.New("[zinx] conn doesn't exit, can't bind user")
+	}
+	// 3. 同一个用户的其他连接按照策略处理
+	var kicked []ziface.IConnection
+	for connID, other := range conn.users[userID] {
+		if connID == connection.GetConnID() {
+			continue
+		}
+		switch conn.duplicateLogin {
+		case DuplicateLoginReject:
+			conn.connLock.Unlock()
+			return ErrDuplicateLogin
+		case DuplicateLoginKick:
+			conn.unbindUser(connID)
+			kicked = append(kicked, other)
+		}
+	}
+	// 4. 绑定: 连接已经绑定其他用户时先解除绑定
+	conn.unbindUser(connection.GetConnID())
+	if _, result := conn.users[userID]; !result {
+		conn.users[userID] = make(map[uint32]ziface.IConnection)
+	}
+	conn.users[userID][connection.GetConnID()] = connection
+	conn.connUsers[connection.GetConnID()] = userID
+	conn.connLock.Unlock()
+	// 5. 踢出旧的连接: 关闭连接时会回调 CloseConnection, 不能在持有锁的时候关闭
+	// 在单独的协程中关闭: 旧连接的钩子函数和等待写入不阻塞新连接的读协程或者事件循环
+	for _, other := range kicked {
+		go conn.kick(other, connection)
+	}
+	return nil
+}
+
+func (conn *ConnManager) UnbindUser(connection ziface.IConnection) {
+	conn.connLock.Lock()
+	defer conn.connLock.Unlock()
+	conn.unbindUser(connection.GetConnID())
+}
+
+func (conn *ConnManager) GetUserConnections(userID string) []ziface.IConnection {
+	conn.connLock.RLock()
+	defer conn.connLock.RUnlock()
+	connections := make([]ziface.IConnection, 0, len(conn.users[userID]))
+	for _, connection := range conn.users[userID] {
+		connections = append(connections, connection)
+	}
+	return connections
+}
+
+func (conn *ConnManager) GetConnectionUser(connection ziface.IConnection) (userID string, ok bool) {
+	conn.connLock.RLock()
+	defer conn.connLock.RUnlock()
+	userID, ok = conn.connUsers[connection.GetConnID()]
+	return userID, ok
+}
+
+func (conn *ConnManager) KickUser(userID string) int {
+	// 1. 取出用户的所有连接并解除绑定
+	conn.connLock.Lock()
+	kicked := make([]ziface.IConnection, 0, len(conn.users[userID]))
+	for connID, connection := range conn.users[userID] {
+		conn.unbindUser(connID)
+		kicked = append(kicked, connection)
+	}
+	conn.connLock.Unlock()
+	// 2. 踢出
+	for _, connection := range kicked {
+		conn.kick(connection, nil)
+	}
+	return len(kicked)
+}
+
+func (conn *ConnManager) SetDuplicateLoginPolicy(policy string) {
+	conn.connLock.Lock()
+	defer conn.connLock.Unlock()
+	conn.duplicateLogin = policy
+}
+
+func (conn *ConnManager) SetOnKick(onKick func(oldConnection ziface.IConnection, newConnection ziface.IConnection)) {
+	conn.connLock.Lock()
+	defer conn.connLock.Unlock()
+	conn.onKick = onKick
+}
+
+// kick 执行钩子函数后关闭旧的连接, 没有设置钩子函数则记录日志; 钩子函数在锁外执行
+func (conn *ConnManager) kick(oldConnection ziface.IConnection, newConnection ziface.IConnection) {
+	conn.connLock.RLock()
+	onKick := conn.onKick
+	conn.connLock.RUnlock()
+	if onKick != nil {
+		onKick(oldConnection, newConnection)
+	} else if newConnection != nil {
+		oldConnection.GetLogger().Warn("[zinx] conn kicked by duplicate login", "new_conn_id", newConnection.GetConnID())
+	} else {
+		oldConnection.GetLogger().Warn("[zinx] conn kicked")
+	}
+	oldConnection.StopConnWithReason(ErrConnKicked)
+}
+
+// unbindUser 连接解除绑定用户 ID, 用户没有连接时删除用户, 调用方需要持有锁
+func (conn *ConnManager) unbindUser(connID uint32) {
+	userID, result := conn.connUsers[connID]
+	if !result {
+		return
+	}
+	delete(conn.connUsers, connID)
+	if connections, result := conn.users[userID]; result {
+		delete(connections, connID)
+		if len(connections) == 0 {
+			delete(conn.users, userID)
+		}
 	}
 }
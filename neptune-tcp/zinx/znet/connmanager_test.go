@@ -0,0 +1,230 @@
+package znet
+
+import (
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startPeerConns 创建并启动多个连接, 对端由测试读取
+func startPeerConns(t *testing.T, server *Server, count int) ([]*Connection, []net.Conn) {
+	t.Helper()
+	conns := make([]*Connection, count)
+	peers := make([]net.Conn, count)
+	for i := range conns {
+		conns[i], peers[i] = newPeerConn(server, uint32(i+1))
+		conns[i].StartConn()
+		t.Cleanup(conns[i].StopConn)
+	}
+	return conns, peers
+}
+
+func TestConnManagerGroups(t *testing.T) {
+	server := newTestServer(t)
+	manager := server.GetConnManager()
+	conns, peers := startPeerConns(t, server, 3)
+	for _, conn := range conns[:2] {
+		if err := manager.JoinGroup("room", conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 1. 分组消息只发送给分组内的连接
+	if err := manager.SendToGroup("room", 1, []byte("room")); err != nil {
+		t.Fatal(err)
+	}
+	for _, peer := range peers[:2] {
+		if _, data := readFrame(t, peer); string(data) != "room" {
+			t.Fatalf("group frame = %q", data)
+		}
+	}
+	// 2. 广播发送给满足条件的连接: 第三个连接收到的第一条消息是广播
+	manager.BroadcastFilter(2, []byte("all"), func(connection ziface.IConnection) bool {
+		return connection.GetConnID() != 1
+	})
+	for _, peer := range peers[1:] {
+		if id, data := readFrame(t, peer); id != 2 || string(data) != "all" {
+			t.Fatalf("broadcast frame = %d %q", id, data)
+		}
+	}
+	// 3. 离开分组; 连接关闭时自动离开所有分组, 不能再加入分组
+	manager.LeaveGroup("room", conns[0])
+	conns[1].StopConn()
+	waitDone(t, conns[1])
+	if connections := manager.GetGroupConnections("room"); len(connections) != 0 {
+		t.Fatalf("group connections = %d", len(connections))
+	}
+	if err := manager.SendToGroup("room", 1, nil); err == nil {
+		t.Fatal("send to empty group succeeded")
+	}
+	if err := manager.JoinGroup("room", conns[1]); err == nil {
+		t.Fatal("closed conn joined group")
+	}
+}
+
+func TestConnManagerDuplicateLoginKick(t *testing.T) {
+	server := newTestServer(t)
+	manager := server.GetConnManager()
+	manager.SetDuplicateLoginPolicy(DuplicateLoginKick)
+	kicked := make(chan [2]ziface.IConnection, 1)
+	manager.SetOnKick(func(oldConnection ziface.IConnection, newConnection ziface.IConnection) {
+		kicked <- [2]ziface.IConnection{oldConnection, newConnection}
+	})
+	conns, _ := startPeerConns(t, server, 2)
+	// 1. 同一个用户再次登录: 踢出旧的连接, 钩子函数收到新旧连接
+	if err := manager.BindUser("user-1", conns[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.BindUser("user-1", conns[1]); err != nil {
+		t.Fatal(err)
+	}
+	if pair := <-kicked; pair[0] != conns[0] || pair[1] != conns[1] {
+		t.Fatalf("kicked = %d -> %d", pair[0].GetConnID(), pair[1].GetConnID())
+	}
+	waitDone(t, conns[0])
+	if !errors.Is(conns[0].GetCloseReason(), ErrConnKicked) {
+		t.Fatalf("reason = %v", conns[0].GetCloseReason())
+	}
+	// 2. 用户只绑定新的连接
+	if users := manager.GetUserConnections("user-1"); len(users) != 1 || users[0] != conns[1] {
+		t.Fatalf("user connections = %v", users)
+	}
+	if _, ok := manager.GetConnectionUser(conns[0]); ok {
+		t.Fatal("kicked conn still bound")
+	}
+}
+
+func TestConnManagerKickAsync(t *testing.T) {
+	server := newTestServer(t)
+	manager := server.GetConnManager()
+	manager.SetDuplicateLoginPolicy(DuplicateLoginKick)
+	stopping := make(chan struct{})
+	release := make(chan struct{})
+	server.SetOnConnStop(func(connection ziface.IConnection) {
+		if connection.GetConnID() == 1 {
+			close(stopping)
+			<-release
+		}
+	})
+	conns, _ := startPeerConns(t, server, 2)
+	defer close(release)
+	if err := manager.BindUser("user-1", conns[0]); err != nil {
+		t.Fatal(err)
+	}
+	// 旧连接的钩子函数阻塞: 新连接绑定用户不等待旧连接关闭
+	bound := make(chan error, 1)
+	go func() {
+		bound <- manager.BindUser("user-1", conns[1])
+	}()
+	select {
+	case err := <-bound:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BindUser blocked by kicked conn")
+	}
+	<-stopping
+	if users := manager.GetUserConnections("user-1"); len(users) != 1 || users[0] != conns[1] {
+		t.Fatalf("user connections = %v", users)
+	}
+}
+
+func TestConnManagerDuplicateLoginReject(t *testing.T) {
+	server := newTestServer(t)
+	manager := server.GetConnManager()
+	manager.SetDuplicateLoginPolicy(DuplicateLoginReject)
+	conns, _ := startPeerConns(t, server, 2)
+	if err := manager.BindUser("user-1", conns[0]); err != nil {
+		t.Fatal(err)
+	}
+	// 同一个用户再次登录: 拒绝新的连接, 旧的连接保持绑定
+	if err := manager.BindUser("user-1", conns[1]); !errors.Is(err, ErrDuplicateLogin) {
+		t.Fatalf("err = %v", err)
+	}
+	if users := manager.GetUserConnections("user-1"); len(users) != 1 || users[0] != conns[0] {
+		t.Fatalf("user connections = %v", users)
+	}
+	if conns[0].GetState() != ziface.ConnStateActive {
+		t.Fatalf("old conn state = %s", conns[0].GetState())
+	}
+}
+
+func TestConnManagerKickUser(t *testing.T) {
+	server := newTestServer(t)
+	manager := server.GetConnManager()
+	conns, _ := startPeerConns(t, server, 3)
+	// 默认允许重复登录: 同一个用户绑定多个连接
+	for _, conn := range conns[:2] {
+		if err := manager.BindUser("user-1", conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := manager.BindUser("user-2", conns[2]); err != nil {
+		t.Fatal(err)
+	}
+	// 踢出用户的所有连接, 其他用户不受影响
+	if count := manager.KickUser("user-1"); count != 2 {
+		t.Fatalf("kicked = %d", count)
+	}
+	for _, conn := range conns[:2] {
+		waitDone(t, conn)
+		if !errors.Is(conn.GetCloseReason(), ErrConnKicked) {
+			t.Fatalf("reason = %v", conn.GetCloseReason())
+		}
+	}
+	if users := manager.GetUserConnections("user-1"); len(users) != 0 {
+		t.Fatalf("user connections = %d", len(users))
+	}
+	if conns[2].GetState() != ziface.ConnStateActive {
+		t.Fatalf("other user conn state = %s", conns[2].GetState())
+	}
+}
+
+func TestConnManagerUnbindOnClose(t *testing.T) {
+	server := newTestServer(t)
+	manager := server.GetConnManager()
+	conns, _ := startPeerConns(t, server, 1)
+	if err := manager.BindUser("user-1", conns[0]); err != nil {
+		t.Fatal(err)
+	}
+	// 连接关闭时自动解除绑定, 已经关闭的连接不能再绑定
+	conns[0].StopConn()
+	waitDone(t, conns[0])
+	if users := manager.GetUserConnections("user-1"); len(users) != 0 {
+		t.Fatalf("user connections = %d", len(users))
+	}
+	if _, ok := manager.GetConnectionUser(conns[0]); ok {
+		t.Fatal("closed conn still bound")
+	}
+	if err := manager.BindUser("user-1", conns[0]); err == nil {
+		t.Fatal("closed conn bound user")
+	}
+}
+
+func TestConnManagerSetOnKickConcurrent(t *testing.T) {
+	server := newTestServer(t)
+	manager := server.GetConnManager()
+	manager.SetDuplicateLoginPolicy(DuplicateLoginKick)
+	conns, _ := startPeerConns(t, server, 8)
+	// 踢出连接的同时设置钩子函数: 需要通过 go test -race 检查
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			manager.SetOnKick(func(oldConnection ziface.IConnection, newConnection ziface.IConnection) {})
+		}
+	}()
+	for _, conn := range conns {
+		if err := manager.BindUser("user-1", conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if users := manager.GetUserConnections("user-1"); len(users) != 1 || users[0] != conns[len(conns)-1] {
+		t.Fatalf("user connections = %v", users)
+	}
+}
@@ -0,0 +1,239 @@
+package znet
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// 事件循环每次最多处理的事件数量
+const eventLoopEvents = 128
+
+// eventLoop 基于 epoll 的事件循环: 读取就绪连接的数据, 解码完整的消息后交给路由器
+type eventLoop struct {
+	server *Server
+	epfd   int
+	// 用于唤醒 epoll_wait, 关闭事件循环
+	wakeFd int
+	// 所有连接共用的读缓冲区, 只有不完整的消息才会复制到连接中
+	buffer []byte
+	conns  map[int]*Connection
+	lock   sync.Mutex
+	// 关闭标志
+	closeOnce sync.Once
+	// 空闲回调在单独的协程中执行: 上一轮回调没有结束时跳过检查
+	idleChecking atomic.Bool
+}
+
+func newPollers(server *Server, count int) ([]poller, error) {
+	pollers := make([]poller, 0, count)
+	for index := 0; index < count; index++ {
+		loop, err := newEventLoop(server)
+		if err != nil {
+			for _, poller := range pollers {
+				poller.close()
+			}
+			return nil, err
+		}
+		go loop.run()
+		pollers = append(pollers, loop)
+	}
+	return pollers, nil
+}
+
+func newEventLoop(server *Server) (*eventLoop, error) {
+	// 1. 创建 epoll
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	// 2. 创建用于唤醒的 eventfd
+	wakeFd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		unix.Close(epfd)
+		return nil, err
+	}
+	event := &unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(wakeFd)}
+	if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, wakeFd, event); err != nil {
+		unix.Close(wakeFd)
+		unix.Close(epfd)
+		return nil, err
+	}
+	return &eventLoop{
+		server: server,
+		epfd:   epfd,
+		wakeFd: wakeFd,
+		buffer: make([]byte, 64*1024),
+		conns:  make(map[int]*Connection),
+	}, nil
+}
+
+func (loop *eventLoop) add(conn *Connection) error {
+	// 1. 获取文件描述符: 连接仍然由 Go 的网络轮询器管理, 写入时使用
+	syscallConn, ok := conn.Conn.(syscall.Conn)
+	if !ok {
+		return errors.New("[zinx] event loop requires syscall conn")
+	}
+	rawConn, err := syscallConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	fd := -1
+	if err := rawConn.Control(func(descriptor uintptr) {
+		fd = int(descriptor)
+	}); err != nil {
+		return err
+	}
+	// 2. 注册连接
+	conn.rawConn = rawConn
+	conn.fd = fd
+	conn.lastRead = time.Now()
+	loop.lock.Lock()
+	loop.conns[fd] = conn
+	loop.lock.Unlock()
+	// 3. 监听可读事件
+	event := &unix.EpollEvent{Events: unix.EPOLLIN | unix.EPOLLRDHUP, Fd: int32(fd)}
+	if err := unix.EpollCtl(loop.epfd, unix.EPOLL_CTL_ADD, fd, event); err != nil {
+		loop.lock.Lock()
+		delete(loop.conns, fd)
+		loop.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (loop *eventLoop) remove(conn *Connection) {
+	loop.lock.Lock()
+	defer loop.lock.Unlock()
+	if loop.conns[conn.fd] != conn {
+		return
+	}
+	delete(loop.conns, conn.fd)
+	// 连接关闭后会自动从 epoll 中移除, 这里忽略错误
+	_ = unix.EpollCtl(loop.epfd, unix.EPOLL_CTL_DEL, conn.fd, nil)
+}
+
+func (loop *eventLoop) close() {
+	loop.closeOnce.Do(func() {
+		// 唤醒 epoll_wait, 由事件循环释放资源
+		var buf [8]byte
+		buf[0] = 1
+		if _, err := unix.Write(loop.wakeFd, buf[:]); err != nil {
+			loop.server.Logger.Warn("[zinx] wake event loop err", "err", err)
+		}
+	})
+}
+
+func (loop *eventLoop) run() {
+	defer unix.Close(loop.wakeFd)
+	defer unix.Close(loop.epfd)
+	events := make([]unix.EpollEvent, eventLoopEvents)
+	for {
+		// 1. 等待就绪事件: 启用空闲检测时每秒唤醒一次
+		idleTimeout := time.Duration(loop.server.GetConfig().ZinxIdleTimeout) * time.Second
+		timeout := -1
+		if idleTimeout > 0 {
+			timeout = 1000
+		}
+		n, err := unix.EpollWait(loop.epfd, events, timeout)
+		if err != nil && err != unix.EINTR {
+			loop.server.Logger.Error("[zinx] epoll wait err", "err", err)
+			return
+		}
+		// 2. 读取就绪的连接
+		for index := 0; index < n; index++ {
+			fd := int(events[index].Fd)
+			if fd == loop.wakeFd {
+				loop.server.Logger.Debug("[zinx] event loop exit")
+				return
+			}
+			loop.lock.Lock()
+			conn := loop.conns[fd]
+			loop.lock.Unlock()
+			if conn != nil {
+				loop.read(conn)
+			}
+		}
+		// 3. 检查空闲连接
+		if idleTimeout > 0 {
+			loop.checkIdle(idleTimeout)
+		}
+	}
+}
+
+// read 读取连接上已经到达的数据并处理其中完整的消息, 出错时关闭连接
+func (loop *eventLoop) read(conn *Connection) {
+	// 1. 非阻塞读取: 回调返回 true 表示不等待 Go 的网络轮询器
+	var n int
+	var readErr error
+	if err := conn.rawConn.Read(func(fd uintptr) bool {
+		n, readErr = unix.Read(int(fd), loop.buffer)
+		return true
+	}); err != nil {
+		readErr = err
+	}
+	if readErr == unix.EAGAIN || readErr == unix.EINTR {
+		return
+	}
+	if readErr == nil && n == 0 {
+		readErr = io.EOF
+	}
+	if readErr != nil {
+		conn.Logger.Debug("[zinx] event loop read err", "err", readErr)
+		conn.stopAsync(readErr)
+		return
+	}
+	conn.lastRead = time.Now()
+	// 2. 拼接上一次不完整的消息
+	data := loop.buffer[:n]
+	if len(conn.pending) > 0 {
+		conn.pending = append(conn.pending, data...)
+		data = conn.pending
+	}
+	// 3. 处理完整的消息, 剩余的数据保存到连接中
+	consumed, err := conn.decodeMessages(data)
+	if err != nil {
+		if err != ErrConnClosed {
+			conn.Logger.Warn("[zinx] event loop decode err", "err", err)
+		}
+		conn.stopAsync(err)
+		return
+	}
+	if consumed == len(data) {
+		conn.pending = nil
+		return
+	}
+	conn.pending = append(conn.pending[:0], data[consumed:]...)
+}
+
+// checkIdle 对超过空闲时间没有收到数据的连接执行空闲回调
+func (loop *eventLoop) checkIdle(idleTimeout time.Duration) {
+	if !loop.idleChecking.CompareAndSwap(false, true) {
+		return
+	}
+	// 1. 复制连接列表: 空闲回调可能关闭连接
+	now := time.Now()
+	var idles []*Connection
+	loop.lock.Lock()
+	for _, conn := range loop.conns {
+		if now.Sub(conn.lastRead) >= idleTimeout {
+			idles = append(idles, conn)
+		}
+	}
+	loop.lock.Unlock()
+	// 2. 重新开始计算空闲时间, 在单独的协程中执行回调: 默认的回调会关闭连接, 不能阻塞事件循环
+	for _, conn := range idles {
+		conn.lastRead = now
+	}
+	go func() {
+		defer loop.idleChecking.Store(false)
+		for _, conn := range idles {
+			conn.Server.GetOnConnIdle(conn)
+		}
+	}()
+}
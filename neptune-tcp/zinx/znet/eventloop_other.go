@@ -0,0 +1,9 @@
+//go:build !linux
+
+package znet
+
+import "errors"
+
+func newPollers(server *Server, count int) ([]poller, error) {
+	return nil, errors.New("[zinx] epoll network mode is only supported on linux")
+}
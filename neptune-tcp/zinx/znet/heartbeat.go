@@ -0,0 +1,35 @@
+package znet
+
+import (
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"net"
+)
+
+const (
+	// HeartbeatPing 心跳探测消息内容
+	HeartbeatPing = "ping"
+	// HeartbeatPong 心跳回复消息内容
+	HeartbeatPong = "pong"
+)
+
+// handleHeartbeat 处理心跳消息: 收到 ping 回复 pong, 收到 pong 直接丢弃; 返回是否是心跳消息
+func handleHeartbeat(heartbeatID uint32, connection ziface.IConnection, message ziface.IMessage) bool {
+	// 1. 检查是否是心跳消息
+	if heartbeatID == 0 || message.GetMessageID() != heartbeatID {
+		return false
+	}
+	// 2. 回复心跳探测
+	if string(message.GetMessageData()) == HeartbeatPing {
+		if err := connection.SendMessage(heartbeatID, []byte(HeartbeatPong)); err != nil {
+			connection.GetLogger().Warn("[zinx] reply heartbeat err", "err", err)
+		}
+	}
+	return true
+}
+
+// isTimeout 判断是否是读写超时
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
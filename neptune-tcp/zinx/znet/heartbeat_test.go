@@ -0,0 +1,81 @@
+package znet
+
+import (
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"testing"
+	"time"
+)
+
+func TestConnIdleClose(t *testing.T) {
+	t.Parallel()
+	config := utils.NewConfiguration()
+	config.ZinxIdleTimeout = 1
+	server := newTestServer(t, WithConfig(config))
+	conn, _ := newTestConn(server, 1)
+	conn.StartConn()
+	// 没有设置钩子函数, 默认关闭空闲连接
+	select {
+	case <-conn.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("idle conn not closed")
+	}
+	if !errors.Is(conn.GetCloseReason(), ErrConnIdle) {
+		t.Fatalf("reason = %v", conn.GetCloseReason())
+	}
+}
+
+func TestConnIdleHook(t *testing.T) {
+	t.Parallel()
+	config := utils.NewConfiguration()
+	config.ZinxIdleTimeout = 1
+	config.ZinxHeartbeatID = 99
+	server := newTestServer(t, WithConfig(config))
+	// 空闲时发送心跳探测, 连接保持打开
+	server.SetOnConnIdle(func(connection ziface.IConnection) {
+		_ = connection.SendMessage(99, []byte(HeartbeatPing))
+	})
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	for i := 0; i < 2; i++ {
+		if id, data := readFrame(t, peer); id != 99 || string(data) != HeartbeatPing {
+			t.Fatalf("probe = %d %q", id, data)
+		}
+		writeFrame(t, peer, 99, []byte(HeartbeatPong))
+	}
+	if conn.GetState() != ziface.ConnStateActive {
+		t.Fatalf("conn state = %s", conn.GetState())
+	}
+}
+
+func TestHeartbeatReply(t *testing.T) {
+	config := utils.NewConfiguration()
+	config.ZinxHeartbeatID = 99
+	server := newTestServer(t, WithConfig(config))
+	var routed bool
+	server.AddRouter(99, &testHandler{handle: func(request ziface.IRequest) {
+		routed = true
+	}})
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		_ = request.GetConn().SendMessage(1, request.GetMessage().GetMessageData())
+	}})
+	server.Router.StartWorkerPool()
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	// 收到 ping 回复 pong, 收到 pong 直接丢弃, 心跳消息不交给路由器
+	writeFrame(t, peer, 99, []byte(HeartbeatPing))
+	if id, data := readFrame(t, peer); id != 99 || string(data) != HeartbeatPong {
+		t.Fatalf("reply = %d %q", id, data)
+	}
+	writeFrame(t, peer, 99, []byte(HeartbeatPong))
+	writeFrame(t, peer, 1, []byte("after"))
+	if id, data := readFrame(t, peer); id != 1 || string(data) != "after" {
+		t.Fatalf("reply = %d %q", id, data)
+	}
+	if routed {
+		t.Fatal("heartbeat routed to handler")
+	}
+}
@@ -0,0 +1,38 @@
+package znet
+
+import (
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"runtime/debug"
+	"time"
+)
+
+// chainInterceptors 包装处理函数: 第一个拦截器在最外层
+func chainInterceptors(handle ziface.HandlerFunc, interceptors []ziface.Interceptor) ziface.HandlerFunc {
+	for index := len(interceptors) - 1; index >= 0; index-- {
+		handle = interceptors[index](handle)
+	}
+	return handle
+}
+
+// RecoveryInterceptor 捕获处理器中的异常, 避免工作协程退出; 路由器默认启用
+func RecoveryInterceptor(next ziface.HandlerFunc) ziface.HandlerFunc {
+	return func(request ziface.IRequest) {
+		defer func() {
+			if err := recover(); err != nil {
+				request.GetConn().GetLogger().Error("[zinx] handler panic", "message_id", request.GetMessage().GetMessageID(),
+					"err", err, "stack", string(debug.Stack()))
+			}
+		}()
+		next(request)
+	}
+}
+
+// TimingInterceptor 记录处理器的耗时
+func TimingInterceptor(next ziface.HandlerFunc) ziface.HandlerFunc {
+	return func(request ziface.IRequest) {
+		start := time.Now()
+		next(request)
+		request.GetConn().GetLogger().Info("[zinx] handle message", "message_id", request.GetMessage().GetMessageID(),
+			"cost", time.Since(start))
+	}
+}
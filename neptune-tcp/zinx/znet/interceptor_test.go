@@ -0,0 +1,85 @@
+package znet
+
+import (
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"reflect"
+	"testing"
+)
+
+// recordInterceptor 进入和退出时记录名称
+func recordInterceptor(name string, records *[]string) ziface.Interceptor {
+	return func(next ziface.HandlerFunc) ziface.HandlerFunc {
+		return func(request ziface.IRequest) {
+			*records = append(*records, name+">")
+			next(request)
+			*records = append(*records, "<"+name)
+		}
+	}
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	server := newTestServer(t)
+	var records []string
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		records = append(records, "handle")
+	}})
+	server.AddInterceptor(recordInterceptor("global1", &records), recordInterceptor("global2", &records))
+	server.AddRouterInterceptor(1, recordInterceptor("handler", &records))
+	server.AddRouterInterceptor(2, recordInterceptor("other", &records))
+	conn, _ := newTestConn(server, 1)
+	defer conn.StopConn()
+	// 全局拦截器按照添加顺序在外层, 消息 ID 对应的拦截器在内层
+	server.Router.RouterHandler(&Request{Message: NewMessage(1, nil), Conn: conn})
+	want := []string{"global1>", "global2>", "handler>", "handle", "<handler", "<global2", "<global1"}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("records = %v, want %v", records, want)
+	}
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	server := newTestServer(t)
+	var records []string
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		panic("boom")
+	}})
+	server.AddInterceptor(recordInterceptor("inner", &records))
+	conn, _ := newTestConn(server, 1)
+	defer conn.StopConn()
+	// 路由器默认启用恢复拦截器: 异常不会传播到工作协程, 内层拦截器不会执行退出的逻辑
+	server.Router.RouterHandler(&Request{Message: NewMessage(1, nil), Conn: conn})
+	if want := []string{"inner>"}; !reflect.DeepEqual(records, want) {
+		t.Fatalf("records = %v, want %v", records, want)
+	}
+}
+
+func TestInterceptorChainCached(t *testing.T) {
+	server := newTestServer(t)
+	var records []string
+	wraps := 0
+	server.AddInterceptor(func(next ziface.HandlerFunc) ziface.HandlerFunc {
+		wraps++
+		return next
+	})
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		records = append(records, "handle")
+	}})
+	conn, _ := newTestConn(server, 1)
+	defer conn.StopConn()
+	// 1. 注册时包装一次, 处理消息时不再重新包装
+	wraps = 0
+	for i := 0; i < 3; i++ {
+		server.Router.RouterHandler(&Request{Message: NewMessage(1, nil), Conn: conn})
+	}
+	if wraps != 0 || len(records) != 3 {
+		t.Fatalf("wraps = %d, records = %v", wraps, records)
+	}
+	// 2. 添加拦截器之后重新包装, 新的拦截器生效
+	records = nil
+	server.AddInterceptor(recordInterceptor("global", &records))
+	server.AddRouterInterceptor(1, recordInterceptor("handler", &records))
+	server.Router.RouterHandler(&Request{Message: NewMessage(1, nil), Conn: conn})
+	want := []string{"global>", "handler>", "handle", "<handler", "<global"}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("records = %v, want %v", records, want)
+	}
+}
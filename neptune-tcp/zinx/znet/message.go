@@ -4,6 +4,9 @@ type Message struct {
 	MessageID     uint32
 	MessageLength uint32
 	MessageData   []byte
+	RequestID     uint32
+	// 来自缓冲池的消息内容, 处理完毕后放回缓冲池
+	buffer *Buffer
 }
 
 func NewMessage(id uint32, data []byte) *Message {
@@ -26,6 +29,10 @@ func (message *Message) GetMessageData() []byte {
 	return message.MessageData
 }
 
+func (message *Message) GetRequestID() uint32 {
+	return message.RequestID
+}
+
 func (message *Message) SetMessageID(messageID uint32) {
 	message.MessageID = messageID
 }
@@ -37,3 +44,7 @@ func (message *Message) SetMessageLength(messageLength uint32) {
 func (message *Message) SetMessageData(messageData []byte) {
 	message.MessageData = messageData
 }
+
+func (message *Message) SetRequestID(requestID uint32) {
+	message.RequestID = requestID
+}
@@ -0,0 +1,175 @@
+package znet
+
+import (
+	"fmt"
+	"io"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 耗时直方图的默认边界
+var defaultLatencyBounds = []time.Duration{
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Metrics 指标收集器: 收发统计使用原子操作, 处理器统计使用锁
+type Metrics struct {
+	messagesIn  uint64
+	messagesOut uint64
+	bytesIn     uint64
+	bytesOut    uint64
+	// 消息 ID 对应的处理器指标
+	handlers    map[uint32]*handlerMetrics
+	handlerLock sync.RWMutex
+	// 耗时直方图的边界
+	bounds []time.Duration
+}
+
+type handlerMetrics struct {
+	count   uint64
+	sum     int64
+	buckets []uint64
+}
+
+func NewMetrics() ziface.IMetrics {
+	return &Metrics{
+		handlers: make(map[uint32]*handlerMetrics),
+		bounds:   defaultLatencyBounds,
+	}
+}
+
+func (metrics *Metrics) RecordHandle(messageID uint32, cost time.Duration) {
+	// 1. 获取处理器指标, 不存在则创建
+	metrics.handlerLock.RLock()
+	handler, result := metrics.handlers[messageID]
+	metrics.handlerLock.RUnlock()
+	if !result {
+		metrics.handlerLock.Lock()
+		if handler, result = metrics.handlers[messageID]; !result {
+			handler = &handlerMetrics{buckets: make([]uint64, len(metrics.bounds))}
+			metrics.handlers[messageID] = handler
+		}
+		metrics.handlerLock.Unlock()
+	}
+	// 2. 记录次数和耗时
+	atomic.AddUint64(&handler.count, 1)
+	atomic.AddInt64(&handler.sum, int64(cost))
+	index := sort.Search(len(metrics.bounds), func(index int) bool {
+		return cost <= metrics.bounds[index]
+	})
+	if index < len(handler.buckets) {
+		atomic.AddUint64(&handler.buckets[index], 1)
+	}
+}
+
+func (metrics *Metrics) RecordRead(bytes int) {
+	atomic.AddUint64(&metrics.messagesIn, 1)
+	atomic.AddUint64(&metrics.bytesIn, uint64(bytes))
+}
+
+func (metrics *Metrics) RecordWrite(bytes int) {
+	atomic.AddUint64(&metrics.messagesOut, 1)
+	atomic.AddUint64(&metrics.bytesOut, uint64(bytes))
+}
+
+func (metrics *Metrics) Snapshot() ziface.MetricsSnapshot {
+	snapshot := ziface.MetricsSnapshot{
+		MessagesIn:  atomic.LoadUint64(&metrics.messagesIn),
+		MessagesOut: atomic.LoadUint64(&metrics.messagesOut),
+		BytesIn:     atomic.LoadUint64(&metrics.bytesIn),
+		BytesOut:    atomic.LoadUint64(&metrics.bytesOut),
+		Handlers:    make(map[uint32]ziface.HandlerMetrics),
+	}
+	metrics.handlerLock.RLock()
+	defer metrics.handlerLock.RUnlock()
+	for messageID, handler := range metrics.handlers {
+		// 直方图转换为累计值
+		buckets := make([]uint64, len(handler.buckets))
+		var total uint64
+		for index := range handler.buckets {
+			total += atomic.LoadUint64(&handler.buckets[index])
+			buckets[index] = total
+		}
+		snapshot.Handlers[messageID] = ziface.HandlerMetrics{
+			Count:   atomic.LoadUint64(&handler.count),
+			Sum:     time.Duration(atomic.LoadInt64(&handler.sum)),
+			Bounds:  metrics.bounds,
+			Buckets: buckets,
+		}
+	}
+	return snapshot
+}
+
+// 关闭指标 HTTP 服务器的超时时间
+const metricsShutdownTimeout = time.Second
+
+// MetricsInterceptor 记录处理器耗时的拦截器: 处理器异常时同样记录, 异常继续交给外层的恢复拦截器
+func MetricsInterceptor(metrics ziface.IMetrics) ziface.Interceptor {
+	return func(next ziface.HandlerFunc) ziface.HandlerFunc {
+		return func(request ziface.IRequest) {
+			start := time.Now()
+			defer func() {
+				metrics.RecordHandle(request.GetMessage().GetMessageID(), time.Since(start))
+			}()
+			next(request)
+		}
+	}
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出服务器指标
+func MetricsHandler(server ziface.IServer) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(writer, server.GetMetricsSnapshot())
+	})
+}
+
+// WritePrometheus 以 Prometheus 文本格式写入指标快照
+func WritePrometheus(writer io.Writer, snapshot ziface.MetricsSnapshot) {
+	// 1. 连接和收发统计
+	fmt.Fprintln(writer, "# TYPE zinx_connections gauge")
+	fmt.Fprintf(writer, "zinx_connections %d\n", snapshot.Connections)
+	fmt.Fprintln(writer, "# TYPE zinx_messages_in_total counter")
+	fmt.Fprintf(writer, "zinx_messages_in_total %d\n", snapshot.MessagesIn)
+	fmt.Fprintln(writer, "# TYPE zinx_messages_out_total counter")
+	fmt.Fprintf(writer, "zinx_messages_out_total %d\n", snapshot.MessagesOut)
+	fmt.Fprintln(writer, "# TYPE zinx_bytes_in_total counter")
+	fmt.Fprintf(writer, "zinx_bytes_in_total %d\n", snapshot.BytesIn)
+	fmt.Fprintln(writer, "# TYPE zinx_bytes_out_total counter")
+	fmt.Fprintf(writer, "zinx_bytes_out_total %d\n", snapshot.BytesOut)
+	// 2. 消息队列积压
+	fmt.Fprintln(writer, "# TYPE zinx_task_queue_depth gauge")
+	for index, depth := range snapshot.TaskQueueDepths {
+		fmt.Fprintf(writer, "zinx_task_queue_depth{queue=\"%d\"} %d\n", index, depth)
+	}
+	// 3. 处理器耗时: 按照消息 ID 排序, 保证输出稳定
+	messageIDs := make([]uint32, 0, len(snapshot.Handlers))
+	for messageID := range snapshot.Handlers {
+		messageIDs = append(messageIDs, messageID)
+	}
+	sort.Slice(messageIDs, func(i, j int) bool {
+		return messageIDs[i] < messageIDs[j]
+	})
+	fmt.Fprintln(writer, "# TYPE zinx_handler_duration_seconds histogram")
+	for _, messageID := range messageIDs {
+		handler := snapshot.Handlers[messageID]
+		for index, bound := range handler.Bounds {
+			fmt.Fprintf(writer, "zinx_handler_duration_seconds_bucket{message_id=\"%d\",le=\"%g\"} %d\n", messageID, bound.Seconds(), handler.Buckets[index])
+		}
+		fmt.Fprintf(writer, "zinx_handler_duration_seconds_bucket{message_id=\"%d\",le=\"+Inf\"} %d\n", messageID, handler.Count)
+		fmt.Fprintf(writer, "zinx_handler_duration_seconds_sum{message_id=\"%d\"} %g\n", messageID, handler.Sum.Seconds())
+		fmt.Fprintf(writer, "zinx_handler_duration_seconds_count{message_id=\"%d\"} %d\n", messageID, handler.Count)
+	}
+}
@@ -0,0 +1,104 @@
+package znet
+
+import (
+	"bytes"
+	"context"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetricsRecordHandle(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.RecordHandle(1, 100*time.Microsecond)
+	metrics.RecordHandle(1, 3*time.Millisecond)
+	metrics.RecordHandle(1, time.Minute)
+	metrics.RecordRead(10)
+	metrics.RecordWrite(20)
+	snapshot := metrics.Snapshot()
+	if snapshot.MessagesIn != 1 || snapshot.BytesIn != 10 || snapshot.MessagesOut != 1 || snapshot.BytesOut != 20 {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+	// 直方图为累计值, 超过最大边界的耗时只计入总数
+	handler := snapshot.Handlers[1]
+	if handler.Count != 3 || handler.Sum != 100*time.Microsecond+3*time.Millisecond+time.Minute {
+		t.Fatalf("handler = %+v", handler)
+	}
+	if handler.Buckets[0] != 1 || handler.Buckets[2] != 2 || handler.Buckets[len(handler.Buckets)-1] != 2 {
+		t.Fatalf("buckets = %v", handler.Buckets)
+	}
+	var buf bytes.Buffer
+	WritePrometheus(&buf, snapshot)
+	for _, line := range []string{
+		`zinx_messages_in_total 1`,
+		`zinx_handler_duration_seconds_bucket{message_id="1",le="0.0005"} 1`,
+		`zinx_handler_duration_seconds_bucket{message_id="1",le="+Inf"} 3`,
+		`zinx_handler_duration_seconds_count{message_id="1"} 3`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("prometheus output missing %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestMetricsSnapshotConcurrent(t *testing.T) {
+	server := newTestServer(t)
+	server.Router.StartWorkerPool()
+	// 记录指标, 创建和关闭连接的同时获取快照
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				server.GetMetrics().RecordHandle(uint32(j%8), time.Millisecond)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				conn, _ := newTestConn(server, uint32(i*100+j+1))
+				conn.StopConn()
+			}
+		}(i)
+	}
+	for i := 0; i < 100; i++ {
+		_ = server.GetMetricsSnapshot()
+	}
+	wg.Wait()
+	if count := server.GetMetricsSnapshot().Handlers[0].Count; count != 4*13 {
+		t.Fatalf("handler count = %d", count)
+	}
+}
+
+func TestMetricsInterceptorCountsPanics(t *testing.T) {
+	server := newTestServer(t)
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		panic("boom")
+	}})
+	conn, _ := newTestConn(server, 1)
+	defer conn.StopConn()
+	server.Router.RouterHandler(&Request{Message: NewMessage(1, nil), Conn: conn})
+	if count := server.GetMetricsSnapshot().Handlers[1].Count; count != 1 {
+		t.Fatalf("panic handler count = %d", count)
+	}
+}
+
+func TestStopMetricsServer(t *testing.T) {
+	config := utils.NewConfiguration()
+	config.ZinxMetricsAddr = "127.0.0.1:0"
+	server := newTestServer(t, WithConfig(config))
+	startTestServer(t, server)
+	// 指标服务器使用单独的超时时间, 不会耗尽停止服务器的截止时间
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Stop(ctx); err != nil {
+		t.Fatalf("stop err = %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("stop consumed the deadline")
+	}
+}
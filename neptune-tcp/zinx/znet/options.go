@@ -0,0 +1,118 @@
+package znet
+
+import (
+	"crypto/tls"
+	"flag"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"time"
+)
+
+// Option 服务器选项: 按照传入顺序依次应用, 后面的选项覆盖前面的配置
+type Option func(server *Server) error
+
+// WithConfig 使用指定的配置, 服务器持有配置的副本
+func WithConfig(config *utils.Configuration) Option {
+	return func(server *Server) error {
+		server.config.Store(config.Clone())
+		return nil
+	}
+}
+
+// WithConfigFile 读取配置文件, 文件中没有出现的字段保持不变
+func WithConfigFile(path string) Option {
+	return func(server *Server) error {
+		server.configPath = path
+		return server.GetConfig().Reload(path)
+	}
+}
+
+// WithConfigWatch 启动服务器后监听 SIGHUP, 并且每隔 interval 检查配置文件是否修改, 需要和 WithConfigFile 一起使用
+// interval 为 0 时只监听 SIGHUP
+func WithConfigWatch(interval time.Duration) Option {
+	return func(server *Server) error {
+		server.watchInterval = interval
+		return nil
+	}
+}
+
+// WithEnv 读取环境变量, 例如前缀为 ZINX_ 时读取 ZINX_PORT, ZINX_MAX_CONN
+func WithEnv(prefix string) Option {
+	return func(server *Server) error {
+		return server.GetConfig().LoadEnv(prefix)
+	}
+}
+
+// WithFlags 解析命令行参数, 例如 -port 2333 -max-conn 100
+// 命令行参数在所有选项之后应用, 重新加载配置文件之后再次应用, 因此优先于 WithConfig 和配置文件
+func WithFlags(flagSet *flag.FlagSet, arguments []string) Option {
+	return func(server *Server) error {
+		if err := utils.NewConfiguration().BindFlags(flagSet); err != nil {
+			return err
+		}
+		if err := flagSet.Parse(arguments); err != nil {
+			return err
+		}
+		server.flagSets = append(server.flagSets, flagSet)
+		return nil
+	}
+}
+
+// applyFlags 按照传入顺序把命令行参数写入配置
+func (server *Server) applyFlags(config *utils.Configuration) error {
+	for _, flagSet := range server.flagSets {
+		if err := config.ApplyFlags(flagSet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithName 设置服务器名称
+func WithName(name string) Option {
+	return func(server *Server) error {
+		server.GetConfig().Name = name
+		return nil
+	}
+}
+
+// WithAddress 设置监听地址
+func WithAddress(ip string, port uint32) Option {
+	return func(server *Server) error {
+		server.GetConfig().IP = ip
+		server.GetConfig().Port = port
+		return nil
+	}
+}
+
+// WithCodec 设置编解码器
+func WithCodec(codec ziface.ICodec) Option {
+	return func(server *Server) error {
+		server.Codec = codec
+		return nil
+	}
+}
+
+// WithLogger 设置日志, 不再根据配置创建
+func WithLogger(logger ziface.ILogger) Option {
+	return func(server *Server) error {
+		server.Logger = logger
+		return nil
+	}
+}
+
+// WithTLSConfig 设置 TLS 配置, 不再读取配置中的证书文件
+func WithTLSConfig(config *tls.Config) Option {
+	return func(server *Server) error {
+		server.TLSConfig = config
+		return nil
+	}
+}
+
+// WithAuthenticator 设置认证器: 连接需要先完成认证, 消息才会交给路由器
+func WithAuthenticator(authenticator ziface.IAuthenticator) Option {
+	return func(server *Server) error {
+		server.Authenticator = authenticator
+		return nil
+	}
+}
@@ -0,0 +1,161 @@
+package znet
+
+import (
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"sync"
+	"time"
+)
+
+// 超过限流时的动作, 定义在配置中
+const (
+	RateLimitActionDrop       = utils.RateLimitActionDrop
+	RateLimitActionDelay      = utils.RateLimitActionDelay
+	RateLimitActionDisconnect = utils.RateLimitActionDisconnect
+)
+
+var ErrRateLimited = errors.New("[zinx] rate limited")
+
+// TokenBucket 令牌桶: 每秒产生 rate 个令牌, 最多积累 burst 个令牌
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	lock   sync.Mutex
+}
+
+func (bucket *TokenBucket) Allow() bool {
+	bucket.lock.Lock()
+	defer bucket.lock.Unlock()
+	bucket.refill(time.Now())
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (bucket *TokenBucket) Cancel() {
+	bucket.lock.Lock()
+	defer bucket.lock.Unlock()
+	bucket.tokens++
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+}
+
+func (bucket *TokenBucket) Reserve() time.Duration {
+	bucket.lock.Lock()
+	defer bucket.lock.Unlock()
+	bucket.refill(time.Now())
+	// 令牌可以透支, 透支的部分由后续产生的令牌偿还
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+// refill 按照经过的时间补充令牌
+func (bucket *TokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens += elapsed.Seconds() * bucket.rate
+		if bucket.tokens > bucket.burst {
+			bucket.tokens = bucket.burst
+		}
+	}
+	bucket.last = now
+}
+
+// NewTokenBucket 创建令牌桶, 初始时令牌是满的; burst 为 0 时等于 rate
+func NewTokenBucket(rate uint32, burst uint32) *TokenBucket {
+	if burst == 0 {
+		burst = rate
+	}
+	return &TokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// newRateLimiter 根据配置创建限流器, 没有配置时返回 nil
+func newRateLimiter(rate uint32, burst uint32) ziface.IRateLimiter {
+	if rate == 0 {
+		return nil
+	}
+	return NewTokenBucket(rate, burst)
+}
+
+// rateLimit 依次检查连接, 消息 ID 和服务器的限流, 返回消息是否可以继续处理
+func (conn *Connection) rateLimit(config *utils.Configuration, message ziface.IMessage) bool {
+	checks := [...]struct {
+		limiter ziface.IRateLimiter
+		scope   ziface.RateLimitScope
+	}{
+		{conn.rateLimiter, ziface.RateLimitScopeConn},
+		{conn.messageRateLimiter(config, message.GetMessageID()), ziface.RateLimitScopeMessage},
+		{conn.Server.GetRateLimiter(), ziface.RateLimitScopeServer},
+	}
+	// 1. 暂停读取: 预留所有范围的令牌, 按照最长的等待时间暂停, 背压会传递到客户端
+	if config.ZinxRateLimitAction == RateLimitActionDelay {
+		var delay time.Duration
+		for _, check := range checks {
+			if check.limiter == nil {
+				continue
+			}
+			if wait := check.limiter.Reserve(); wait > 0 {
+				conn.Server.GetOnRateLimited(conn, message, check.scope)
+				if wait > delay {
+					delay = wait
+				}
+			}
+		}
+		if delay == 0 {
+			return true
+		}
+		// 1.1 等待期间连接关闭, 直接返回
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return true
+		case <-conn.done:
+			return false
+		}
+	}
+	// 2. 丢弃消息或者断开连接: 所有范围都允许时才消耗令牌, 被拒绝时归还前面范围获取的令牌
+	for index, check := range checks {
+		if check.limiter == nil || check.limiter.Allow() {
+			continue
+		}
+		for _, allowed := range checks[:index] {
+			if allowed.limiter != nil {
+				allowed.limiter.Cancel()
+			}
+		}
+		conn.Server.GetOnRateLimited(conn, message, check.scope)
+		if config.ZinxRateLimitAction == RateLimitActionDisconnect {
+			conn.stopAsync(ErrRateLimited)
+		}
+		return false
+	}
+	return true
+}
+
+// messageRateLimiter 获取消息 ID 的限流器, 只在读协程中调用
+func (conn *Connection) messageRateLimiter(config *utils.Configuration, messageID uint32) ziface.IRateLimiter {
+	rate := config.ZinxMessageRateLimits[messageID]
+	if rate == 0 {
+		return nil
+	}
+	limiter, ok := conn.messageRateLimiters[messageID]
+	if !ok {
+		limiter = NewTokenBucket(rate, 0)
+		conn.messageRateLimiters[messageID] = limiter
+	}
+	return limiter
+}
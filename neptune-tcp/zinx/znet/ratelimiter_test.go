@@ -0,0 +1,142 @@
+package znet
+
+import (
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := NewTokenBucket(1000, 2)
+	// 1. 初始时令牌是满的, 用完之后拒绝
+	if !bucket.Allow() || !bucket.Allow() || bucket.Allow() {
+		t.Fatal("burst not respected")
+	}
+	// 2. 归还的令牌可以再次获取, 不超过容量
+	bucket.Cancel()
+	if !bucket.Allow() {
+		t.Fatal("cancelled token not available")
+	}
+	// 3. 按照速率补充令牌
+	time.Sleep(5 * time.Millisecond)
+	if !bucket.Allow() {
+		t.Fatal("token not refilled")
+	}
+	// 4. 预留可以透支, 返回需要等待的时间
+	bucket = NewTokenBucket(10, 1)
+	if wait := bucket.Reserve(); wait != 0 {
+		t.Fatalf("first reserve wait = %v", wait)
+	}
+	if wait := bucket.Reserve(); wait < 50*time.Millisecond || wait > 100*time.Millisecond {
+		t.Fatalf("second reserve wait = %v", wait)
+	}
+}
+
+// newRateLimitConn 创建限流的连接, 记录触发限流的范围
+func newRateLimitConn(t *testing.T, action string, modify func(config *utils.Configuration)) (*Connection, *utils.Configuration, chan ziface.RateLimitScope) {
+	t.Helper()
+	config := utils.NewConfiguration()
+	config.ZinxRateLimitAction = action
+	modify(config)
+	server := newTestServer(t, WithConfig(config))
+	scopes := make(chan ziface.RateLimitScope, 16)
+	server.SetOnRateLimited(func(connection ziface.IConnection, message ziface.IMessage, scope ziface.RateLimitScope) {
+		scopes <- scope
+	})
+	conn, _ := newTestConn(server, 1)
+	t.Cleanup(conn.StopConn)
+	return conn, server.GetConfig(), scopes
+}
+
+func TestRateLimitDrop(t *testing.T) {
+	conn, config, scopes := newRateLimitConn(t, RateLimitActionDrop, func(config *utils.Configuration) {
+		config.ZinxConnRateLimit, config.ZinxConnRateBurst = 1, 2
+		config.ZinxServerRateLimit, config.ZinxServerRateBurst = 1, 1
+	})
+	message := NewMessage(1, nil)
+	if !conn.rateLimit(config, message) {
+		t.Fatal("first message limited")
+	}
+	// 1. 服务器范围拒绝: 丢弃消息, 连接范围不消耗令牌, 连接保持打开
+	if conn.rateLimit(config, message) {
+		t.Fatal("second message allowed")
+	}
+	if scope := <-scopes; scope != ziface.RateLimitScopeServer {
+		t.Fatalf("scope = %s", scope)
+	}
+	if conn.isClosed() {
+		t.Fatal("conn closed by drop action")
+	}
+	if !conn.rateLimiter.Allow() || conn.rateLimiter.Allow() {
+		t.Fatal("conn token spent by rejected message")
+	}
+}
+
+func TestRateLimitMessageScope(t *testing.T) {
+	conn, config, scopes := newRateLimitConn(t, RateLimitActionDrop, func(config *utils.Configuration) {
+		config.ZinxMessageRateLimits = map[uint32]uint32{2: 1}
+	})
+	if !conn.rateLimit(config, NewMessage(2, nil)) || conn.rateLimit(config, NewMessage(2, nil)) {
+		t.Fatal("message limit not applied")
+	}
+	if scope := <-scopes; scope != ziface.RateLimitScopeMessage {
+		t.Fatalf("scope = %s", scope)
+	}
+	// 其他消息 ID 不受限制
+	if !conn.rateLimit(config, NewMessage(1, nil)) {
+		t.Fatal("other message limited")
+	}
+}
+
+func TestRateLimitDisconnect(t *testing.T) {
+	conn, config, scopes := newRateLimitConn(t, RateLimitActionDisconnect, func(config *utils.Configuration) {
+		config.ZinxConnRateLimit = 1
+	})
+	message := NewMessage(1, nil)
+	if !conn.rateLimit(config, message) || conn.rateLimit(config, message) {
+		t.Fatal("conn limit not applied")
+	}
+	if scope := <-scopes; scope != ziface.RateLimitScopeConn {
+		t.Fatalf("scope = %s", scope)
+	}
+	waitDone(t, conn)
+	if !errors.Is(conn.GetCloseReason(), ErrRateLimited) {
+		t.Fatalf("reason = %v", conn.GetCloseReason())
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	conn, config, scopes := newRateLimitConn(t, RateLimitActionDelay, func(config *utils.Configuration) {
+		config.ZinxConnRateLimit = 50
+		config.ZinxConnRateBurst = 1
+	})
+	message := NewMessage(1, nil)
+	if !conn.rateLimit(config, message) {
+		t.Fatal("first message limited")
+	}
+	// 1. 等待令牌之后继续处理
+	start := time.Now()
+	if !conn.rateLimit(config, message) {
+		t.Fatal("delayed message dropped")
+	}
+	if cost := time.Since(start); cost < 15*time.Millisecond {
+		t.Fatalf("delay = %v", cost)
+	}
+	if scope := <-scopes; scope != ziface.RateLimitScopeConn {
+		t.Fatalf("scope = %s", scope)
+	}
+	// 2. 等待期间连接关闭, 立即返回
+	for i := 0; i < 50; i++ {
+		conn.rateLimiter.Reserve()
+	}
+	time.AfterFunc(10*time.Millisecond, conn.StopConn)
+	start = time.Now()
+	if conn.rateLimit(config, message) {
+		t.Fatal("message handled after conn closed")
+	}
+	if cost := time.Since(start); cost > 500*time.Millisecond {
+		t.Fatalf("delay not interrupted by close, cost = %v", cost)
+	}
+}
@@ -0,0 +1,143 @@
+package znet
+
+import (
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+// 可以在运行时修改的字段, 其余字段需要重启服务器才能生效
+// 需要额外处理的字段返回错误时没有生效, 同样记录为需要重启
+var reloadableFields = map[string]func(server *Server, config *utils.Configuration) error{
+	"ZinxMaxConn":         nil,
+	"ZinxMaxPackage":      nil,
+	"ZinxIdleTimeout":     nil,
+	"ZinxHandlerTimeout":  nil,
+	"ZinxHandlerTimeouts": nil,
+	"ZinxLogLevel": func(server *Server, config *utils.Configuration) error {
+		server.Logger.SetLevel(zlog.ParseLevel(config.ZinxLogLevel))
+		return nil
+	},
+	"ZinxWorkerPoolSize": func(server *Server, config *utils.Configuration) error {
+		return server.Router.ResizeWorkerPool(config.ZinxWorkerPoolSize)
+	},
+	"ZinxDuplicateLogin": func(server *Server, config *utils.Configuration) error {
+		server.ConnManager.SetDuplicateLoginPolicy(config.ZinxDuplicateLogin)
+		return nil
+	},
+}
+
+func (server *Server) ReloadConfig() (ziface.ConfigChange, error) {
+	change, err := server.reloadConfig()
+	if server.OnConfigReload != nil {
+		server.OnConfigReload(change, err)
+	}
+	return change, err
+}
+
+func (server *Server) reloadConfig() (ziface.ConfigChange, error) {
+	var change ziface.ConfigChange
+	if server.configPath == "" {
+		return change, errors.New("[zinx] server not created with config file, can't reload")
+	}
+	server.reloadLock.Lock()
+	defer server.reloadLock.Unlock()
+	// 1. 在当前配置的基础上读取配置文件并校验, 文件中没有出现的字段保持不变
+	current := server.GetConfig()
+	loaded := current.Clone()
+	if err := loaded.Reload(server.configPath); err != nil {
+		return change, err
+	}
+	if err := server.applyFlags(loaded); err != nil {
+		return change, err
+	}
+	if err := loaded.Validate(); err != nil {
+		return change, err
+	}
+	// 2. 只复制可以在运行时修改的字段, 其余字段记录为需要重启
+	next := current.Clone()
+	for _, field := range current.Diff(loaded) {
+		if _, result := reloadableFields[field]; !result {
+			change.RestartRequired = append(change.RestartRequired, field)
+			continue
+		}
+		change.Applied = append(change.Applied, field)
+	}
+	next.ZinxMaxConn = loaded.ZinxMaxConn
+	next.ZinxMaxPackage = loaded.ZinxMaxPackage
+	next.ZinxIdleTimeout = loaded.ZinxIdleTimeout
+	next.ZinxLogLevel = loaded.ZinxLogLevel
+	next.ZinxWorkerPoolSize = loaded.ZinxWorkerPoolSize
+	next.ZinxDuplicateLogin = loaded.ZinxDuplicateLogin
+	next.ZinxHandlerTimeout = loaded.ZinxHandlerTimeout
+	next.ZinxHandlerTimeouts = loaded.ZinxHandlerTimeouts
+	// 3. 需要额外处理的字段: 没有生效时恢复原来的取值, 记录为需要重启
+	applied := change.Applied[:0]
+	for _, field := range change.Applied {
+		if apply := reloadableFields[field]; apply != nil {
+			if err := apply(server, next); err != nil {
+				server.Logger.Warn("[zinx] reload config field not applied", "field", field, "err", err)
+				reflect.ValueOf(next).Elem().FieldByName(field).Set(reflect.ValueOf(current).Elem().FieldByName(field))
+				change.RestartRequired = append(change.RestartRequired, field)
+				continue
+			}
+		}
+		applied = append(applied, field)
+	}
+	change.Applied = applied
+	// 4. 替换配置, 连接在下一次读取时使用新的配置
+	server.config.Store(next)
+	server.Logger.Info("[zinx] reload config", "path", server.configPath, "applied", change.Applied, "restart_required", change.RestartRequired)
+	return change, nil
+}
+
+func (server *Server) SetOnConfigReload(onConfigReload func(change ziface.ConfigChange, err error)) {
+	server.OnConfigReload = onConfigReload
+}
+
+// watchConfig 收到 SIGHUP 或者配置文件修改时重新加载配置, 服务器关闭时退出
+func (server *Server) watchConfig(interval time.Duration) {
+	// 1. 监听 SIGHUP
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	// 2. 定时检查配置文件的修改时间, 间隔为 0 时只监听信号
+	var ticker <-chan time.Time
+	if interval > 0 {
+		timer := time.NewTicker(interval)
+		defer timer.Stop()
+		ticker = timer.C
+	}
+	modTime := configModTime(server.configPath)
+	for {
+		select {
+		case <-signals:
+			server.Logger.Info("[zinx] receive SIGHUP, reload config")
+		case <-ticker:
+			latest := configModTime(server.configPath)
+			if latest.Equal(modTime) {
+				continue
+			}
+			modTime = latest
+		case <-server.exitChan:
+			return
+		}
+		if _, err := server.ReloadConfig(); err != nil {
+			server.Logger.Error("[zinx] reload config err", "path", server.configPath, "err", err)
+		}
+	}
+}
+
+func configModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -1,11 +1,79 @@
 package znet
 
-import "neptune-golang/neptune-tcp/zinx/ziface"
+import (
+	"context"
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrHandlerTimeout = errors.New("[zinx] handler timeout")
+	ErrAlreadyReplied = errors.New("[zinx] request already replied")
+)
+
+// 请求的回复状态: 只会从 pending 变为 replied 或者 timedOut, 超时之后可以再回复一次错误变为 replied
+// 处理器的回复和处理超时的回复互斥, 每个请求最多回复一次
+const (
+	replyPending int32 = iota
+	replyReplied
+	replyTimedOut
+)
 
 // Request 请求
 type Request struct {
 	Message ziface.IMessage
 	Conn    ziface.IConnection
+	// 请求的上下文: 为空时使用连接的上下文; 配置了处理超时时, 超时或者处理完毕后取消
+	ctx    context.Context
+	cancel func()
+	// 回复状态: 超时之后处理器的回复会被丢弃, 已经回复之后不再执行超时的钩子函数
+	replyState atomic.Int32
+}
+
+// newRequest 创建请求: 配置了处理超时的消息从收到时开始计时, 超时后取消上下文并执行超时的钩子函数
+func newRequest(conn *Connection, config *utils.Configuration, message ziface.IMessage) *Request {
+	request := &Request{
+		Message: message,
+		Conn:    conn,
+	}
+	// 1. 获取消息 ID 的处理超时时间
+	timeout, ok := config.ZinxHandlerTimeouts[message.GetMessageID()]
+	if !ok {
+		timeout = config.ZinxHandlerTimeout
+	}
+	if timeout == 0 {
+		return request
+	}
+	// 2. 超时后执行钩子函数: 连接关闭导致的取消不属于超时, 处理器已经回复时不再执行
+	ctx, cancel := context.WithTimeout(conn.Context(), time.Duration(timeout)*time.Millisecond)
+	hookDone := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(hookDone)
+		if ctx.Err() != context.DeadlineExceeded || !request.replyState.CompareAndSwap(replyPending, replyTimedOut) {
+			return
+		}
+		conn.Server.GetOnHandlerTimeout(request)
+	})
+	request.ctx = ctx
+	// 3. 钩子函数已经开始执行时等待执行完毕: 钩子函数可能仍在读取消息, 之后消息内容才能放回缓冲池
+	request.cancel = func() {
+		if !stop() {
+			<-hookDone
+		}
+		cancel()
+	}
+	return request
+}
+
+// releaseRequest 请求处理完毕或者被丢弃: 停止处理超时的计时, 等待正在执行的超时钩子函数, 消息内容放回缓冲池
+func releaseRequest(request ziface.IRequest) {
+	if req, ok := request.(*Request); ok && req.cancel != nil {
+		req.cancel()
+	}
+	releaseMessage(request.GetMessage())
 }
 
 func (request *Request) GetMessage() ziface.IMessage {
@@ -15,3 +83,39 @@ func (request *Request) GetMessage() ziface.IMessage {
 func (request *Request) GetConn() ziface.IConnection {
 	return request.Conn
 }
+
+func (request *Request) GetIdentity() ziface.IIdentity {
+	return request.Conn.GetIdentity()
+}
+
+func (request *Request) GetRequestID() uint32 {
+	return request.Message.GetRequestID()
+}
+
+func (request *Request) Context() context.Context {
+	if request.ctx != nil {
+		return request.ctx
+	}
+	return request.Conn.Context()
+}
+
+// claimReply 回复之前占用请求的回复: 已经超时返回 ErrHandlerTimeout, 已经回复返回 ErrAlreadyReplied
+func claimReply(request ziface.IRequest) error {
+	req, ok := request.(*Request)
+	if !ok || req.replyState.CompareAndSwap(replyPending, replyReplied) {
+		return nil
+	}
+	if req.replyState.Load() == replyTimedOut {
+		return ErrHandlerTimeout
+	}
+	return ErrAlreadyReplied
+}
+
+// claimErrorReply 回复错误之前占用请求的回复: 超时之后仍然可以回复一次错误, 例如超时的钩子函数回复超时错误
+func claimErrorReply(request ziface.IRequest) error {
+	req, ok := request.(*Request)
+	if !ok || req.replyState.CompareAndSwap(replyPending, replyReplied) || req.replyState.CompareAndSwap(replyTimedOut, replyReplied) {
+		return nil
+	}
+	return ErrAlreadyReplied
+}
@@ -1,77 +1,389 @@
 package znet
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"math/rand"
 	"neptune-golang/neptune-tcp/zinx/utils"
 	"neptune-golang/neptune-tcp/zinx/ziface"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 任务分发策略, 定义在配置中
+const (
+	DispatchModeHash        = utils.DispatchModeHash
+	DispatchModeRoundRobin  = utils.DispatchModeRoundRobin
+	DispatchModeLeastLoaded = utils.DispatchModeLeastLoaded
+	DispatchModeInline      = utils.DispatchModeInline
+)
+
+var (
+	ErrResizeInline = errors.New("[zinx] dispatch mode inline has no worker pool to resize")
 )
 
 type Router struct {
 	// 处理器集合
 	Apis map[uint32]ziface.IHandler
+	// 全局拦截器
+	Interceptors []ziface.Interceptor
+	// 消息 ID 对应的拦截器
+	HandlerInterceptors map[uint32][]ziface.Interceptor
+	// 包装好拦截器的处理函数: 注册处理器或者拦截器时重新包装, 处理消息时直接调用
+	handles map[uint32]ziface.HandlerFunc
 	// 消息队列集合: 可以只使用一个管道作为消息队列
 	TaskQueues []chan ziface.IRequest
+	// 通知单个工作协程退出的管道: 缩小工作协程池时使用
+	workerExits []chan struct{}
+	// 工作协程退出后关闭的管道: 哈希分发调整工作协程池时等待全部退出
+	workerDones []chan struct{}
+	// 每个消息队列正在发送的请求数量: 工作协程退出前等待发送完成, 避免请求留在已经移除的消息队列
+	queueSenders []*atomic.Int32
 	// 最大协程数量
 	MaxWorkerPoolSize uint32
+	// 保护消息队列集合: 调整工作协程池大小时加写锁
+	poolLock    sync.RWMutex
+	poolStarted bool
+	// 每个消息队列的长度
+	TaskQueueSize uint32
+	// 任务分发策略
+	DispatchMode string
+	// 轮询计数器
+	roundRobin uint32
+	// 日志
+	Logger ziface.ILogger
+	// 通知工作协程退出的管道
+	exitChan chan struct{}
+	exitOnce sync.Once
+	// 等待工作协程全部退出
+	workerGroup sync.WaitGroup
 }
 
-func NewRouter() ziface.IRouter {
+func NewRouter(config *utils.Configuration) ziface.IRouter {
+	// 没有工作协程时直接在读协程中处理
+	dispatchMode := config.ZinxDispatchMode
+	if config.ZinxWorkerPoolSize == 0 {
+		dispatchMode = DispatchModeInline
+	}
 	return &Router{
-		Apis:              make(map[uint32]ziface.IHandler),
-		TaskQueues:        make([]chan ziface.IRequest, utils.Config.ZinxWorkerPoolSize),
-		MaxWorkerPoolSize: utils.Config.ZinxWorkerPoolSize,
+		Apis:                make(map[uint32]ziface.IHandler),
+		Interceptors:        []ziface.Interceptor{RecoveryInterceptor},
+		HandlerInterceptors: make(map[uint32][]ziface.Interceptor),
+		handles:             make(map[uint32]ziface.HandlerFunc),
+		TaskQueues:          make([]chan ziface.IRequest, config.ZinxWorkerPoolSize),
+		workerExits:         make([]chan struct{}, config.ZinxWorkerPoolSize),
+		workerDones:         make([]chan struct{}, config.ZinxWorkerPoolSize),
+		queueSenders:        newQueueSenders(config.ZinxWorkerPoolSize),
+		MaxWorkerPoolSize:   config.ZinxWorkerPoolSize,
+		TaskQueueSize:       config.ZinxTaskQueueSize,
+		DispatchMode:        dispatchMode,
+		Logger:              zlog.Default(),
+		exitChan:            make(chan struct{}),
 	}
 }
 
 func (router *Router) RouterHandler(request ziface.IRequest) {
+	// 0. 处理完毕后停止处理超时的计时, 消息内容放回缓冲池
+	defer releaseRequest(request)
 	// 1. 获取处理器: 如果没有找到, 那么返回类型对应的零值; 如果存在, 那么就返回对应值
 	handler, result := router.Apis[request.GetMessage().GetMessageID()]
 	// 2. 检查是否存在
 	if !result {
-		fmt.Println("[zinx] router not found handler to handle message")
+		request.GetConn().GetLogger().Warn("[zinx] router not found handler to handle message", "message_id", request.GetMessage().GetMessageID())
 		return
 	}
-	// 3. 处理消息
-	handler.PreHandle(request)
-	handler.Handle(request)
-	handler.PostHandle(request)
+	// 3. 处理消息: 直接设置到 Apis 的处理器没有包装好的处理函数, 需要临时包装
+	handle, result := router.handles[request.GetMessage().GetMessageID()]
+	if !result {
+		handle = router.buildHandle(request.GetMessage().GetMessageID(), handler)
+	}
+	handle(request)
+}
+
+// buildHandle 包装处理函数: 由外到内依次经过全局拦截器和消息 ID 对应的拦截器
+func (router *Router) buildHandle(id uint32, handler ziface.IHandler) ziface.HandlerFunc {
+	handle := func(request ziface.IRequest) {
+		handler.PreHandle(request)
+		handler.Handle(request)
+		handler.PostHandle(request)
+	}
+	handle = chainInterceptors(handle, router.HandlerInterceptors[id])
+	return chainInterceptors(handle, router.Interceptors)
+}
+
+// rebuildHandle 处理器或者拦截器变化之后重新包装处理函数
+func (router *Router) rebuildHandle(id uint32) {
+	if handler, result := router.Apis[id]; result {
+		router.handles[id] = router.buildHandle(id, handler)
+	}
 }
 
 func (router *Router) AddHandler(id uint32, handler ziface.IHandler) {
-	// 1. 检查是否存在
+	// 1. 检查是否使用了保留位: 注册之后永远不会被调用, 属于编程错误
+	if id&reservedIDBits != 0 {
+		panic(fmt.Sprintf("[zinx] message id %#x use reserved bits %#x in router", id, reservedIDBits))
+	}
+	// 2. 检查是否存在
 	if _, result := router.Apis[id]; result {
-		fmt.Println("[zinx] already exit same message id handler in router ")
+		router.Logger.Warn("[zinx] already exit same message id handler in router", "message_id", id)
 		return
 	}
-	// 2. 添加处理器
+	// 3. 添加处理器
 	router.Apis[id] = handler
+	router.rebuildHandle(id)
+}
+
+func (router *Router) AddInterceptor(interceptors ...ziface.Interceptor) {
+	router.Interceptors = append(router.Interceptors, interceptors...)
+	// 全局拦截器变化: 重新包装所有处理函数
+	for id := range router.Apis {
+		router.rebuildHandle(id)
+	}
+}
+
+func (router *Router) AddHandlerInterceptor(id uint32, interceptors ...ziface.Interceptor) {
+	router.HandlerInterceptors[id] = append(router.HandlerInterceptors[id], interceptors...)
+	router.rebuildHandle(id)
 }
 
 func (router *Router) StartWorkerPool() {
-	fmt.Println("[zinx] starting worker pool: worker size ", router.MaxWorkerPoolSize, " queue size", utils.Config.ZinxTaskQueueSize)
+	// 直接在读协程中处理, 不需要启动工作协程
+	if router.isInline() {
+		router.Logger.Info("[zinx] dispatch mode inline, worker pool not start")
+		return
+	}
+	router.poolLock.Lock()
+	defer router.poolLock.Unlock()
+	router.Logger.Info("[zinx] starting worker pool", "worker_size", router.MaxWorkerPoolSize, "queue_size", router.TaskQueueSize, "dispatch_mode", router.DispatchMode)
 	// 直接启动
 	for index := 0; index < int(router.MaxWorkerPoolSize); index++ {
-		fmt.Println("[zinx] worker pool start ", index, " goroutine ")
-		// 开启协程
-		router.TaskQueues[index] = make(chan ziface.IRequest, utils.Config.ZinxTaskQueueSize)
-		go router.StartWorker(router.TaskQueues[index])
+		router.startWorker(index)
+	}
+	router.poolStarted = true
+}
+
+func newQueueSenders(size uint32) []*atomic.Int32 {
+	senders := make([]*atomic.Int32, size)
+	for index := range senders {
+		senders[index] = &atomic.Int32{}
+	}
+	return senders
+}
+
+func (router *Router) ResizeWorkerPool(size uint32) error {
+	// 1. 直接在读协程中处理, 没有工作协程池
+	if router.isInline() {
+		return ErrResizeInline
+	}
+	if size == 0 {
+		return errors.New("[zinx] worker pool size must be greater than 0")
+	}
+	router.poolLock.Lock()
+	defer router.poolLock.Unlock()
+	current := router.MaxWorkerPoolSize
+	if size == current {
+		return nil
+	}
+	router.Logger.Info("[zinx] resize worker pool", "from", current, "to", size)
+	// 0. 哈希分发: 调整数量会改变连接对应的消息队列, 需要重建整个工作协程池
+	if router.DispatchMode == DispatchModeHash && router.poolStarted {
+		router.rebuildWorkerPool(size)
+		return nil
+	}
+	// 1. 缩小: 移除多余的消息队列, 对应的工作协程处理完剩余的请求后退出
+	if size < current {
+		for index := size; index < current; index++ {
+			if router.workerExits[index] != nil {
+				close(router.workerExits[index])
+			}
+		}
+		router.TaskQueues = router.TaskQueues[:size]
+		router.workerExits = router.workerExits[:size]
+		router.workerDones = router.workerDones[:size]
+		router.queueSenders = router.queueSenders[:size]
+		router.MaxWorkerPoolSize = size
+		return nil
+	}
+	// 2. 扩大: 添加消息队列, 工作协程池已经启动时同时启动工作协程
+	for index := current; index < size; index++ {
+		router.TaskQueues = append(router.TaskQueues, nil)
+		router.workerExits = append(router.workerExits, nil)
+		router.workerDones = append(router.workerDones, nil)
+		router.queueSenders = append(router.queueSenders, &atomic.Int32{})
+		if router.poolStarted {
+			router.startWorker(int(index))
+		}
+	}
+	router.MaxWorkerPoolSize = size
+	return nil
+}
+
+// rebuildWorkerPool 重建工作协程池, 调用方需要持有写锁
+// 持有写锁时不能选择消息队列, 新的请求等待重建完成; 所有工作协程处理完旧消息队列中的请求并退出之后才创建新的消息队列
+// 因此同一个连接的请求不会同时存在于新旧两个消息队列, 顺序保持不变
+func (router *Router) rebuildWorkerPool(size uint32) {
+	// 1. 通知所有工作协程退出并等待: 工作协程会等待正在发送的请求, 处理完剩余的请求
+	for _, workerExit := range router.workerExits {
+		close(workerExit)
+	}
+	for _, workerDone := range router.workerDones {
+		<-workerDone
+	}
+	// 2. 按照新的数量创建消息队列并启动工作协程
+	router.TaskQueues = make([]chan ziface.IRequest, size)
+	router.workerExits = make([]chan struct{}, size)
+	router.workerDones = make([]chan struct{}, size)
+	router.queueSenders = newQueueSenders(size)
+	router.MaxWorkerPoolSize = size
+	for index := 0; index < int(size); index++ {
+		router.startWorker(index)
+	}
+}
+
+// startWorker 创建消息队列并启动工作协程, 调用方需要持有写锁
+func (router *Router) startWorker(index int) {
+	taskQueue, workerExit, workerDone, senders := make(chan ziface.IRequest, router.TaskQueueSize), make(chan struct{}), make(chan struct{}), router.queueSenders[index]
+	router.TaskQueues[index], router.workerExits[index], router.workerDones[index] = taskQueue, workerExit, workerDone
+	router.workerGroup.Add(1)
+	go func() {
+		defer close(workerDone)
+		router.StartWorker(taskQueue, workerExit, senders)
+	}()
+}
+
+func (router *Router) StopWorkerPool(ctx context.Context) error {
+	// 1. 通知所有工作协程退出
+	router.exitOnce.Do(func() {
+		close(router.exitChan)
+	})
+	// 2. 等待工作协程处理完队列中剩余的请求
+	done := make(chan struct{})
+	go func() {
+		router.workerGroup.Wait()
+		close(done)
+	}()
+	// 3. 超过截止时间直接返回, 剩余的请求不再等待
+	select {
+	case <-done:
+		router.Logger.Info("[zinx] worker pool stop, all task queues drained")
+		return nil
+	case <-ctx.Done():
+		router.Logger.Warn("[zinx] worker pool stop timeout, task queues not drained", "err", ctx.Err())
+		return ctx.Err()
 	}
 }
 
-func (router *Router) StartWorker(taskQueue chan ziface.IRequest) {
+func (router *Router) StartWorker(taskQueue chan ziface.IRequest, workerExit chan struct{}, senders *atomic.Int32) {
+	defer router.workerGroup.Done()
 	for {
 		select {
 		case request := <-taskQueue:
 			router.RouterHandler(request)
+		case <-router.exitChan:
+			router.drainTaskQueue(taskQueue, senders)
+			return
+		case <-workerExit:
+			router.drainTaskQueue(taskQueue, senders)
+			return
+		}
+	}
+}
+
+// drainTaskQueue 退出前等待正在发送的请求, 然后处理完队列中已经存在的请求
+// 消息队列已经不能被选中, 正在发送的请求数量只会减少
+func (router *Router) drainTaskQueue(taskQueue chan ziface.IRequest, senders *atomic.Int32) {
+	for {
+		select {
+		case request := <-taskQueue:
+			router.RouterHandler(request)
+		default:
+			if senders.Load() == 0 && len(taskQueue) == 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
 		}
 	}
 }
 
 func (router *Router) SendMessageToTaskQueue(request ziface.IRequest) {
-	// 1. 随机负载均衡
-	id := rand.Int31n(int32(router.MaxWorkerPoolSize))
-	// 2. 选择消息队列, 发送消息
-	fmt.Println("[zinx] read goroutine send message to no.", id, " task queue")
-	router.TaskQueues[id] <- request
+	// 1. 直接在读协程中处理
+	if router.isInline() {
+		select {
+		case <-router.exitChan:
+			request.GetConn().GetLogger().Warn("[zinx] worker pool already stop, drop message", "message_id", request.GetMessage().GetMessageID())
+			releaseRequest(request)
+		default:
+			router.RouterHandler(request)
+		}
+		return
+	}
+	// 2. 工作协程池已经停止, 丢弃请求
+	select {
+	case <-router.exitChan:
+		request.GetConn().GetLogger().Warn("[zinx] worker pool already stop, drop message", "message_id", request.GetMessage().GetMessageID())
+		releaseRequest(request)
+		return
+	default:
+	}
+	// 3. 持有读锁选择消息队列并记录正在发送, 释放读锁之后发送: 消息队列已满时不会阻塞调整工作协程池
+	router.poolLock.RLock()
+	id := router.selectTaskQueue(request)
+	taskQueue, senders := router.TaskQueues[id], router.queueSenders[id]
+	senders.Add(1)
+	router.poolLock.RUnlock()
+	defer senders.Add(-1)
+	// 3.1 记录正在发送之后再次检查: 工作协程可能在记录之前已经看到没有正在发送的请求并退出
+	select {
+	case <-router.exitChan:
+		request.GetConn().GetLogger().Warn("[zinx] worker pool already stop, drop message", "message_id", request.GetMessage().GetMessageID())
+		releaseRequest(request)
+		return
+	default:
+	}
+	select {
+	case taskQueue <- request:
+	case <-router.exitChan:
+		// 工作协程已经退出, 丢弃请求
+		request.GetConn().GetLogger().Warn("[zinx] worker pool already stop, drop message", "message_id", request.GetMessage().GetMessageID())
+		releaseRequest(request)
+	}
+}
+
+func (router *Router) SetLogger(logger ziface.ILogger) {
+	router.Logger = logger
+}
+
+func (router *Router) GetTaskQueueDepths() []int {
+	router.poolLock.RLock()
+	defer router.poolLock.RUnlock()
+	depths := make([]int, len(router.TaskQueues))
+	for index, taskQueue := range router.TaskQueues {
+		depths[index] = len(taskQueue)
+	}
+	return depths
+}
+
+func (router *Router) selectTaskQueue(request ziface.IRequest) uint32 {
+	switch router.DispatchMode {
+	case DispatchModeRoundRobin:
+		return (atomic.AddUint32(&router.roundRobin, 1) - 1) % router.MaxWorkerPoolSize
+	case DispatchModeLeastLoaded:
+		// 选择积压请求最少的消息队列
+		var id uint32
+		for index := 1; index < len(router.TaskQueues); index++ {
+			if len(router.TaskQueues[index]) < len(router.TaskQueues[id]) {
+				id = uint32(index)
+			}
+		}
+		return id
+	default:
+		// 同一个连接始终由同一个工作协程处理, 保证消息有序
+		return request.GetConn().GetConnID() % router.MaxWorkerPoolSize
+	}
+}
+
+func (router *Router) isInline() bool {
+	return router.DispatchMode == DispatchModeInline
 }
@@ -0,0 +1,385 @@
+package znet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestRouter 创建没有启动工作协程的路由器, 消息队列由测试直接读写
+func newTestRouter(mode string, size uint32) *Router {
+	config := utils.NewConfiguration()
+	config.ZinxDispatchMode = mode
+	config.ZinxWorkerPoolSize = size
+	router := NewRouter(config).(*Router)
+	for index := range router.TaskQueues {
+		router.TaskQueues[index] = make(chan ziface.IRequest, config.ZinxTaskQueueSize)
+	}
+	return router
+}
+
+func TestSelectTaskQueue(t *testing.T) {
+	server := newTestServer(t)
+	conns := make([]*Connection, 8)
+	for i := range conns {
+		conns[i], _ = newTestConn(server, uint32(i+1))
+		defer conns[i].StopConn()
+	}
+	// 1. 哈希: 同一个连接始终选择同一个消息队列
+	router := newTestRouter(DispatchModeHash, 4)
+	for _, conn := range conns {
+		for i := 0; i < 3; i++ {
+			if id := router.selectTaskQueue(&Request{Conn: conn}); id != conn.GetConnID()%4 {
+				t.Fatalf("hash conn %d queue = %d", conn.GetConnID(), id)
+			}
+		}
+	}
+	// 2. 轮询: 与连接无关, 依次选择每个消息队列
+	router = newTestRouter(DispatchModeRoundRobin, 4)
+	for i := 0; i < 8; i++ {
+		if id := router.selectTaskQueue(&Request{Conn: conns[0]}); id != uint32(i%4) {
+			t.Fatalf("round robin %d queue = %d", i, id)
+		}
+	}
+	// 3. 最少积压: 选择积压请求最少的消息队列, 相同时选择编号最小的
+	router = newTestRouter(DispatchModeLeastLoaded, 3)
+	router.TaskQueues[0] <- &Request{Conn: conns[0]}
+	router.TaskQueues[0] <- &Request{Conn: conns[0]}
+	router.TaskQueues[2] <- &Request{Conn: conns[0]}
+	if id := router.selectTaskQueue(&Request{Conn: conns[0]}); id != 1 {
+		t.Fatalf("least loaded queue = %d", id)
+	}
+	router.TaskQueues[1] <- &Request{Conn: conns[0]}
+	if id := router.selectTaskQueue(&Request{Conn: conns[0]}); id != 1 {
+		t.Fatalf("least loaded queue = %d", id)
+	}
+}
+
+func TestSendMessageToTaskQueue(t *testing.T) {
+	server := newTestServer(t)
+	conn, _ := newTestConn(server, 3)
+	defer conn.StopConn()
+	// 1. 哈希: 请求进入连接对应的消息队列, 等待工作协程处理
+	router := newTestRouter(DispatchModeHash, 2)
+	router.SendMessageToTaskQueue(&Request{Message: NewMessage(1, nil), Conn: conn})
+	if depths := router.GetTaskQueueDepths(); depths[0] != 0 || depths[1] != 1 {
+		t.Fatalf("depths = %v", depths)
+	}
+	// 2. 内联: 在调用方的协程中直接处理
+	router = newTestRouter(DispatchModeInline, 2)
+	var handled bool
+	router.AddHandler(1, &testHandler{handle: func(request ziface.IRequest) {
+		handled = true
+	}})
+	router.SendMessageToTaskQueue(&Request{Message: NewMessage(1, nil), Conn: conn})
+	if !handled {
+		t.Fatal("inline request not handled")
+	}
+	// 3. 没有工作协程时使用内联
+	if router := newTestRouter(DispatchModeRoundRobin, 0); !router.isInline() {
+		t.Fatalf("dispatch mode = %s", router.DispatchMode)
+	}
+}
+
+func TestStopWorkerPoolConcurrentSend(t *testing.T) {
+	server := newTestServer(t)
+	conn, _ := newTestConn(server, 1)
+	defer conn.StopConn()
+	for round := 0; round < 50; round++ {
+		router := newTestRouter(DispatchModeRoundRobin, 2)
+		router.Logger = zlog.NewNopLogger()
+		router.StartWorkerPool()
+		// 停止工作协程池的同时发送请求: 每个请求要么被处理, 要么被丢弃, 都会释放, 不会留在消息队列中
+		var sent, released atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					sent.Add(1)
+					router.SendMessageToTaskQueue(&Request{Message: NewMessage(1, nil), Conn: conn, cancel: func() {
+						released.Add(1)
+					}})
+				}
+			}()
+		}
+		if err := router.StopWorkerPool(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		wg.Wait()
+		if released.Load() != sent.Load() {
+			t.Fatalf("round %d: released = %d, sent = %d", round, released.Load(), sent.Load())
+		}
+	}
+}
+
+func TestResizeWorkerPool(t *testing.T) {
+	server := newTestServer(t)
+	conn, _ := newTestConn(server, 1)
+	defer conn.StopConn()
+	router := newTestRouter(DispatchModeRoundRobin, 2)
+	router.Logger = zlog.NewNopLogger()
+	var handled atomic.Int32
+	router.AddHandler(1, &testHandler{handle: func(request ziface.IRequest) {
+		handled.Add(1)
+	}})
+	router.StartWorkerPool()
+	// 1. 发送请求的同时扩大和缩小工作协程池: 移除的消息队列中的请求全部处理, 不会丢失
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				router.SendMessageToTaskQueue(&Request{Message: NewMessage(1, nil), Conn: conn})
+			}
+		}()
+	}
+	for _, size := range []uint32{4, 1, 3, 2, 1} {
+		if err := router.ResizeWorkerPool(size); err != nil {
+			t.Fatal(err)
+		}
+		if depths := router.GetTaskQueueDepths(); len(depths) != int(size) {
+			t.Fatalf("queues = %d, want %d", len(depths), size)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := router.StopWorkerPool(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if handled.Load() != 8*500 {
+		t.Fatalf("handled = %d, want %d", handled.Load(), 8*500)
+	}
+}
+
+func TestResizeWorkerPoolUnsupported(t *testing.T) {
+	// 内联没有工作协程池
+	if err := newTestRouter(DispatchModeInline, 2).ResizeWorkerPool(4); !errors.Is(err, ErrResizeInline) {
+		t.Fatalf("inline resize err = %v", err)
+	}
+}
+
+func TestResizeWorkerPoolHashOrder(t *testing.T) {
+	server := newTestServer(t)
+	router := newTestRouter(DispatchModeHash, 2)
+	router.Logger = zlog.NewNopLogger()
+	// 记录每个连接处理到的序号: 序号不连续说明乱序
+	var lock sync.Mutex
+	next := make(map[uint32]int)
+	var disorder atomic.Int32
+	router.AddHandler(1, &testHandler{handle: func(request ziface.IRequest) {
+		sequence, _ := strconv.Atoi(string(request.GetMessage().GetMessageData()))
+		lock.Lock()
+		defer lock.Unlock()
+		if next[request.GetConn().GetConnID()] != sequence {
+			disorder.Add(1)
+		}
+		next[request.GetConn().GetConnID()] = sequence + 1
+	}})
+	router.StartWorkerPool()
+	// 1. 每个连接按顺序发送请求的同时扩大和缩小工作协程池
+	var wg sync.WaitGroup
+	for connID := uint32(1); connID <= 8; connID++ {
+		conn, _ := newTestConn(server, connID)
+		defer conn.StopConn()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sequence := 0; sequence < 500; sequence++ {
+				router.SendMessageToTaskQueue(&Request{Message: NewMessage(1, []byte(strconv.Itoa(sequence))), Conn: conn})
+			}
+		}()
+	}
+	for _, size := range []uint32{4, 1, 3, 2, 5} {
+		if err := router.ResizeWorkerPool(size); err != nil {
+			t.Fatal(err)
+		}
+		if depths := router.GetTaskQueueDepths(); len(depths) != int(size) {
+			t.Fatalf("queues = %d, want %d", len(depths), size)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := router.StopWorkerPool(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 2. 请求全部处理, 每个连接的请求保持有序
+	if disorder.Load() != 0 {
+		t.Fatalf("disorder = %d", disorder.Load())
+	}
+	for connID := uint32(1); connID <= 8; connID++ {
+		if next[connID] != 500 {
+			t.Fatalf("conn %d handled = %d, want 500", connID, next[connID])
+		}
+	}
+}
+
+func TestResizeBlockedSend(t *testing.T) {
+	server := newTestServer(t)
+	conn, _ := newTestConn(server, 1)
+	defer conn.StopConn()
+	config := utils.NewConfiguration()
+	config.ZinxDispatchMode = DispatchModeRoundRobin
+	config.ZinxWorkerPoolSize = 1
+	config.ZinxTaskQueueSize = 1
+	router := NewRouter(config).(*Router)
+	release := make(chan struct{})
+	router.AddHandler(1, &testHandler{handle: func(request ziface.IRequest) {
+		<-release
+	}})
+	router.StartWorkerPool()
+	// 1. 工作协程阻塞, 消息队列已满, 发送阻塞
+	for i := 0; i < 3; i++ {
+		go router.SendMessageToTaskQueue(&Request{Message: NewMessage(1, nil), Conn: conn})
+	}
+	time.Sleep(10 * time.Millisecond)
+	// 2. 阻塞的发送不持有锁, 调整工作协程池不会被阻塞
+	resized := make(chan error, 1)
+	go func() {
+		resized <- router.ResizeWorkerPool(2)
+	}()
+	select {
+	case err := <-resized:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("resize blocked by full task queue")
+	}
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := router.StopWorkerPool(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadWorkerPoolSize(t *testing.T) {
+	for mode, applied := range map[string]bool{
+		DispatchModeRoundRobin: true,
+		DispatchModeHash:       true,
+		DispatchModeInline:     false,
+	} {
+		path := filepath.Join(t.TempDir(), "zinx.json")
+		write := func(size int) {
+			data := []byte(fmt.Sprintf(`{"ZinxDispatchMode": %q, "ZinxWorkerPoolSize": %d}`, mode, size))
+			if err := os.WriteFile(path, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		write(2)
+		server := newTestServer(t, WithConfigFile(path))
+		write(4)
+		change, err := server.ReloadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 不能调整工作协程池时记录为需要重启, 配置保持原来的取值
+		want := ziface.ConfigChange{Applied: []string{"ZinxWorkerPoolSize"}}
+		size := uint32(4)
+		if !applied {
+			want = ziface.ConfigChange{Applied: []string{}, RestartRequired: []string{"ZinxWorkerPoolSize"}}
+			size = 2
+		}
+		if !reflect.DeepEqual(change, want) || server.GetConfig().ZinxWorkerPoolSize != size {
+			t.Fatalf("%s: change = %+v, size = %d", mode, change, server.GetConfig().ZinxWorkerPoolSize)
+		}
+	}
+}
+
+func TestHandlerTimeoutSingleReply(t *testing.T) {
+	config := utils.NewConfiguration()
+	config.ZinxHandlerTimeouts = map[uint32]uint32{1: 20}
+	server := newTestServer(t, WithConfig(config))
+	// 处理器在超时前后完成: 交替回复成功和错误, 和超时的钩子函数回复的超时错误竞争
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		data := request.GetMessage().GetMessageData()
+		delay, _ := time.ParseDuration(string(data))
+		time.Sleep(delay)
+		if delay%(2*time.Millisecond) == 0 {
+			_ = request.GetConn().Reply(request, data)
+		} else {
+			_ = ReplyError(request, NewStatusError(CodeInternal, "internal error"))
+		}
+	}})
+	startWorkers(t, server)
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	// 每个请求只收到一帧: 处理器的回复或者超时错误
+	for delay := 15 * time.Millisecond; delay <= 25*time.Millisecond; delay += time.Millisecond / 2 {
+		writeFrame(t, peer, 1, []byte(delay.String()))
+		if id, _ := readFrame(t, peer); id&^ErrorFlag != 1 {
+			t.Fatalf("reply id = %#x", id)
+		}
+		_ = peer.SetReadDeadline(time.Now().Add(30 * time.Millisecond))
+		var netErr interface{ Timeout() bool }
+		if _, err := peer.Read(make([]byte, 1)); !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("delay %v: second frame, read err = %v", delay, err)
+		}
+	}
+}
+
+func TestHandlerTimeoutHookReadsMessage(t *testing.T) {
+	config := utils.NewConfiguration()
+	config.ZinxHandlerTimeouts = map[uint32]uint32{1: 5}
+	server := newTestServer(t, WithConfig(config))
+	// 处理器在钩子函数执行期间处理完毕: 钩子函数读取消息时, 消息内容不能已经放回缓冲池
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		time.Sleep(15 * time.Millisecond)
+	}})
+	hooked := make(chan string, 1)
+	server.SetOnHandlerTimeout(func(request ziface.IRequest) {
+		time.Sleep(20 * time.Millisecond)
+		hooked <- string(request.GetMessage().GetMessageData())
+	})
+	startWorkers(t, server)
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	writeFrame(t, peer, 1, []byte("slow request"))
+	select {
+	case data := <-hooked:
+		if data != "slow request" {
+			t.Fatalf("hook read message = %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler timeout hook not called")
+	}
+}
+
+func TestReplyOnce(t *testing.T) {
+	server := newTestServer(t)
+	conn, _ := newTestConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	request := newRequest(conn, server.GetConfig(), NewMessage(1, nil))
+	defer releaseRequest(request)
+	if err := conn.Reply(request, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	// 已经回复之后再次回复或者回复错误都会被丢弃
+	if err := conn.Reply(request, []byte("second")); !errors.Is(err, ErrAlreadyReplied) {
+		t.Fatalf("second reply err = %v", err)
+	}
+	if err := ReplyError(request, NewStatusError(CodeInternal, "internal error")); !errors.Is(err, ErrAlreadyReplied) {
+		t.Fatalf("reply error err = %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package znet
+
+import (
+	"context"
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"net"
+	"testing"
+	"time"
+)
+
+// newQueueConn 创建发送队列长度为 2 的连接: 没有启动写协程, 发送队列不会被消费
+func newQueueConn(t *testing.T, policy string) (*Connection, net.Conn) {
+	t.Helper()
+	config := utils.NewConfiguration()
+	config.ZinxSendQueueSize = 2
+	config.ZinxSendQueuePolicy = policy
+	server := newTestServer(t, WithConfig(config))
+	conn, peer := newPeerConn(server, 1)
+	t.Cleanup(func() {
+		conn.StopConn()
+		_ = peer.Close()
+	})
+	for i := 0; i < 2; i++ {
+		if err := conn.SendMessage(1, []byte("queued")); err != nil {
+			t.Fatalf("send %d err = %v", i, err)
+		}
+	}
+	return conn, peer
+}
+
+func TestSendQueuePolicyDrop(t *testing.T) {
+	conn, _ := newQueueConn(t, SendQueuePolicyDrop)
+	if err := conn.SendMessage(1, []byte("dropped")); !errors.Is(err, ErrSendQueueFull) {
+		t.Fatalf("send err = %v", err)
+	}
+	if conn.isClosed() {
+		t.Fatal("conn closed by drop policy")
+	}
+}
+
+func TestSendQueuePolicyDisconnect(t *testing.T) {
+	conn, _ := newQueueConn(t, SendQueuePolicyDisconnect)
+	if err := conn.SendMessage(1, []byte("overflow")); !errors.Is(err, ErrSendQueueFull) {
+		t.Fatalf("send err = %v", err)
+	}
+	waitDone(t, conn)
+	if !errors.Is(conn.GetCloseReason(), ErrSendQueueFull) {
+		t.Fatalf("reason = %v", conn.GetCloseReason())
+	}
+}
+
+func TestSendQueuePolicyBlock(t *testing.T) {
+	conn, _ := newQueueConn(t, SendQueuePolicyBlock)
+	// 1. 阻塞发送在 ctx 结束时返回
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := conn.SendMessageBlocking(ctx, 1, []byte("timeout")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("blocking send err = %v", err)
+	}
+	// 2. 发送队列已满时阻塞, 连接关闭后返回
+	sent := make(chan error, 1)
+	go func() {
+		sent <- conn.SendMessage(1, []byte("blocked"))
+	}()
+	select {
+	case err := <-sent:
+		t.Fatalf("send returned early, err = %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	conn.StopConn()
+	select {
+	case err := <-sent:
+		if !errors.Is(err, ErrConnClosed) {
+			t.Fatalf("send err = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked send not released by close")
+	}
+}
+
+func TestSendQueuePolicyBlockDrains(t *testing.T) {
+	conn, peer := newQueueConn(t, SendQueuePolicyBlock)
+	sent := make(chan error, 1)
+	go func() {
+		sent <- conn.SendMessage(1, []byte("blocked"))
+	}()
+	// 写协程消费发送队列之后阻塞的发送完成, 消息按照顺序写入
+	conn.StartConn()
+	for _, want := range []string{"queued", "queued", "blocked"} {
+		if _, data := readFrame(t, peer); string(data) != want {
+			t.Fatalf("frame = %q, want %q", data, want)
+		}
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("send err = %v", err)
+	}
+}
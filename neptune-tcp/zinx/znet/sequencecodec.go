@@ -0,0 +1,58 @@
+package znet
+
+import (
+	"encoding/binary"
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+)
+
+// SequenceCodec 携带请求序列号的编解码器: 消息 ID 4B + 请求序列号 4B + 消息长度 4B
+// 同一个连接上的响应可以乱序返回, 客户端根据请求序列号匹配
+type SequenceCodec struct {
+}
+
+func NewSequenceCodec() ziface.ICodec {
+	return &SequenceCodec{}
+}
+
+func (codec *SequenceCodec) GetHeadLength() uint32 {
+	// 消息 ID 4B + 请求序列号 4B + 消息长度 4B
+	return 12
+}
+
+func (codec *SequenceCodec) Encode(message ziface.IMessage) (data []byte, err error) {
+	buffer, err := codec.EncodeBuffer(message)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.B, nil
+}
+
+func (codec *SequenceCodec) EncodeBuffer(message ziface.IMessage) (*Buffer, error) {
+	// 1. 从缓冲池获取缓冲区
+	buffer := GetBuffer(int(codec.GetHeadLength() + message.GetMessageLength()))
+	buf := buffer.B
+	// 2. 写入消息 ID
+	binary.LittleEndian.PutUint32(buf[0:4], message.GetMessageID())
+	// 3. 写入请求序列号
+	binary.LittleEndian.PutUint32(buf[4:8], message.GetRequestID())
+	// 4. 写入消息长度
+	binary.LittleEndian.PutUint32(buf[8:12], message.GetMessageLength())
+	// 5. 写入消息内容
+	copy(buf[12:], message.GetMessageData())
+	return buffer, nil
+}
+
+func (codec *SequenceCodec) Decode(data []byte) (message ziface.IMessage, err error) {
+	// 1. 检查头部长度
+	if uint32(len(data)) < codec.GetHeadLength() {
+		return nil, errors.New("[zinx] receive head buf too short")
+	}
+	// 2. 读取消息 ID、请求序列号和消息长度
+	response := &Message{
+		MessageID:     binary.LittleEndian.Uint32(data[0:4]),
+		RequestID:     binary.LittleEndian.Uint32(data[4:8]),
+		MessageLength: binary.LittleEndian.Uint32(data[8:12]),
+	}
+	return response, nil
+}
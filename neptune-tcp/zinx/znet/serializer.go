@@ -0,0 +1,56 @@
+package znet
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// JSONSerializer JSON 序列化器: 类型化路由默认使用
+type JSONSerializer struct {
+}
+
+func NewJSONSerializer() *JSONSerializer {
+	return &JSONSerializer{}
+}
+
+func (serializer *JSONSerializer) Name() string {
+	return "json"
+}
+
+func (serializer *JSONSerializer) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (serializer *JSONSerializer) Unmarshal(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
+
+// ProtobufSerializer protobuf 序列化器: 请求和响应类型需要是 protoc 生成的消息
+type ProtobufSerializer struct {
+}
+
+func NewProtobufSerializer() *ProtobufSerializer {
+	return &ProtobufSerializer{}
+}
+
+func (serializer *ProtobufSerializer) Name() string {
+	return "protobuf"
+}
+
+func (serializer *ProtobufSerializer) Marshal(value interface{}) ([]byte, error) {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("[zinx] protobuf serializer can't marshal %T", value)
+	}
+	return proto.Marshal(message)
+}
+
+func (serializer *ProtobufSerializer) Unmarshal(data []byte, value interface{}) error {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return fmt.Errorf("[zinx] protobuf serializer can't unmarshal %T", value)
+	}
+	return proto.Unmarshal(data, message)
+}
@@ -1,10 +1,25 @@
 package znet
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
+	"io"
 	"neptune-golang/neptune-tcp/zinx/utils"
 	"neptune-golang/neptune-tcp/zinx/ziface"
-	"net"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 网络模型, 定义在配置中
+const (
+	NetworkModeGoroutine = utils.NetworkModeGoroutine
+	NetworkModeEpoll     = utils.NetworkModeEpoll
 )
 
 type Server struct {
@@ -16,13 +31,52 @@ type Server struct {
 	IP string
 	// 端口号
 	Port uint32
+	// 配置: 每个服务器独立持有, 热加载时整体替换
+	config atomic.Pointer[utils.Configuration]
+	// 配置文件路径: 用于热加载
+	configPath string
+	// 热加载: 检查配置文件的间隔, 小于 0 表示不监听
+	watchInterval time.Duration
+	reloadLock    sync.Mutex
+	// 命令行参数: 应用所有选项之后以及每次重新加载配置之后写入配置
+	flagSets []*flag.FlagSet
+	// 热加载配置的钩子函数
+	OnConfigReload func(change ziface.ConfigChange, err error)
 	// 路由器
 	Router ziface.IRouter
 	// 连接管理器
 	ConnManager ziface.IConnManager
+	// 编解码器: 所有连接共用
+	Codec ziface.ICodec
+	// TLS 配置: 为空时不启用 TLS
+	TLSConfig *tls.Config
+	// 日志
+	Logger ziface.ILogger
+	// 指标收集器
+	Metrics ziface.IMetrics
+	// 指标 HTTP 服务器
+	metricsServer *http.Server
+	// 认证器: 为空表示连接不需要认证
+	Authenticator ziface.IAuthenticator
+	// 服务器所有连接共享的限流器, 为空表示不限流
+	RateLimiter ziface.IRateLimiter
+	// 处理超时的钩子函数
+	OnHandlerTimeout func(request ziface.IRequest)
+	// 超过限流的钩子函数
+	OnRateLimited func(connection ziface.IConnection, message ziface.IMessage, scope ziface.RateLimitScope)
 	// 钩子函数
 	OnConnStart func(connection ziface.IConnection)
 	OnConnStop  func(connection ziface.IConnection)
+	OnConnIdle  func(connection ziface.IConnection)
+	// 监听器
+	// 监听器: 流式传输为 net.Listener, 数据报传输为 net.PacketConn
+	listener     io.Closer
+	listenerLock sync.Mutex
+	// 事件循环模式: 所有事件循环
+	pollers []poller
+	// 服务器关闭的通知管道
+	exitChan chan struct{}
+	exitOnce sync.Once
 }
 
 // Start 在方法名前声明接受者的方法, 是属于结构体方法
@@ -30,42 +84,69 @@ func (server *Server) Start() {
 	// 最外层添加异步处理, 避免同步阻塞建立连接
 	go func() {
 		// 服务器正式启动
-		fmt.Printf("[%s] Server Listener at IP :%s, Port :%d\n", server.Name, server.IP, server.Port)
+		server.Logger.Info("[zinx] server listener", "name", server.Name, "ip", server.IP, "port", server.Port)
 		// 0. 启动线程池
 		server.Router.StartWorkerPool()
-		// 1. 获取 TCP 对象
-		addr, err := net.ResolveTCPAddr(server.IPVersion, fmt.Sprintf("%s:%d", server.IP, server.Port))
-		// 错误处理
-		if err != nil {
-			fmt.Println("resolve tcp addr error: ", err)
+		// 0.1 启动指标 HTTP 服务器
+		server.startMetricsServer()
+		// 0.2 监听配置文件变化
+		if server.configPath != "" && server.watchInterval >= 0 {
+			go server.watchConfig(server.watchInterval)
+		}
+		// 0.3 事件循环模式: 启动事件循环
+		if !server.startPollers() {
+			return
+		}
+		// 1. 数据报传输: 没有连接, 按照客户端地址创建虚拟连接
+		if isDatagramNetwork(server.IPVersion) {
+			server.serveDatagram()
 			return
 		}
 
-		// 2. 获取监听器对象
-		listener, err := net.ListenTCP(server.IPVersion, addr)
+		// 2. 获取监听器对象: TCP 或者 Unix 域套接字
+		listener, err := server.listen()
 		if err != nil {
-			fmt.Println("listen ", server.IPVersion, " err", err)
+			server.Logger.Error("[zinx] listen err", "ip_version", server.IPVersion, "err", err)
+			return
+		}
+		// 2.1 启用 TLS: 握手在连接的协程中完成, 不阻塞接收新的连接
+		if server.TLSConfig != nil {
+			listener = tls.NewListener(listener, server.TLSConfig)
+		}
+		// 2.2 保存监听器, 如果服务器已经关闭, 那么直接释放
+		if !server.setListener(listener) {
+			listener.Close()
 			return
 		}
 
-		fmt.Println("start Zinx server", server.Name, " success, Listening...")
+		server.Logger.Info("[zinx] start server success, listening...", "name", server.Name)
 		// 3. 阻塞等待客户端的连接
 		var connID uint32 = 0
 		for {
 			connID++
-			connection, err := listener.AcceptTCP()
+			connection, err := listener.Accept()
 			if err != nil {
-				fmt.Println("Accept err", err)
+				// 监听器关闭后不再接收新的连接
+				if server.isStopped() {
+					server.Logger.Info("[zinx] server stop, accept goroutine exit")
+					return
+				}
+				server.Logger.Warn("[zinx] accept err", "err", err)
 				continue
 			}
 			// 4 判断是否已经超过连接上限
-			if server.ConnManager.GetConnectionCount() >= utils.Config.ZinxMaxConn {
+			maxConn := server.GetConfig().ZinxMaxConn
+			if server.ConnManager.GetConnectionCount() >= maxConn {
 				connection.Close()
-				fmt.Println("[zinx] conn count already up to max ", utils.Config.ZinxMaxConn, ", must close some conn")
+				server.Logger.Warn("[zinx] conn count already up to max, must close some conn", "max_conn", maxConn, "remote_addr", connection.RemoteAddr().String())
 				continue
 			}
-			// 5. 处理业务逻辑: go 声明方法异步执行 协程
-			go NewConn(connID, connection, server.Router, server).StartConn()
+			// 5. 处理业务逻辑: go 声明方法异步执行 协程; 事件循环模式下按照连接 ID 选择事件循环
+			dealConn := NewConn(connID, connection, server.Router, server)
+			if len(server.pollers) > 0 {
+				dealConn.poller = server.pollers[connID%uint32(len(server.pollers))]
+			}
+			go dealConn.StartConn()
 		}
 	}()
 
@@ -77,24 +158,211 @@ func (server *Server) Serve() {
 
 	// TODO 服务器启动后的额外状态
 
-	// 2. 阻塞服务器, 避免主进程结束导致整个服务器停止
-	select {}
+	// 2. 阻塞服务器直到调用 Stop, 避免主进程结束导致整个服务器停止
+	<-server.exitChan
 }
 
-func (server *Server) Stop() {
-	// 服务器关闭前释放相应的资源
+func (server *Server) Stop(ctx context.Context) error {
+	server.Logger.Info("[zinx] server close, will release all connections")
+	// 1. 通知服务器关闭
+	server.exitOnce.Do(func() {
+		close(server.exitChan)
+	})
+	// 2. 关闭监听器, 不再接收新的连接: 数据报传输的虚拟连接通过监听器回复, 最后关闭
+	datagram := isDatagramNetwork(server.IPVersion)
+	if !datagram {
+		server.closeListener()
+	}
+	// 3. 停止工作协程池: 不再接收新的请求, 等待任务队列中的请求处理完毕
+	err := server.Router.StopWorkerPool(ctx)
+	// 4. 等待处理器的回复写入后释放所有连接
+	for _, connection := range server.ConnManager.GetConnections() {
+		if conn, ok := connection.(*Connection); ok {
+			conn.waitFlushed(ctx)
+		}
+	}
 	server.ConnManager.CloseConnections()
-	fmt.Println("[zinx] server close, will release all connections")
+	if datagram {
+		server.closeListener()
+	}
+	// 4.1 关闭指标 HTTP 服务器: 使用单独的超时时间, 不占用停止服务器的截止时间, 不在持有锁的时候等待
+	server.listenerLock.Lock()
+	metricsServer := server.metricsServer
+	server.listenerLock.Unlock()
+	if metricsServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			server.Logger.Warn("[zinx] close metrics server err", "err", err)
+		}
+		cancel()
+	}
+	// 4.2 关闭事件循环
+	server.listenerLock.Lock()
+	for _, poller := range server.pollers {
+		poller.close()
+	}
+	server.listenerLock.Unlock()
+	return err
+}
+
+func (server *Server) closeListener() {
+	server.listenerLock.Lock()
+	defer server.listenerLock.Unlock()
+	if server.listener != nil {
+		if err := server.listener.Close(); err != nil {
+			server.Logger.Warn("[zinx] close listener err", "err", err)
+		}
+	}
+}
+
+// startPollers 事件循环模式: 启动事件循环, 返回 false 表示服务器无法继续启动
+func (server *Server) startPollers() bool {
+	config := server.GetConfig()
+	if config.ZinxNetworkMode != NetworkModeEpoll {
+		return true
+	}
+	// 1. 事件循环直接读取套接字, 不支持 TLS
+	if server.TLSConfig != nil {
+		server.Logger.Error("[zinx] epoll network mode doesn't support tls")
+		return false
+	}
+	// 2. 创建事件循环: 默认数量为 CPU 核数
+	count := int(config.ZinxEventLoops)
+	if count == 0 {
+		count = runtime.NumCPU()
+	}
+	pollers, err := newPollers(server, count)
+	if err != nil {
+		server.Logger.Error("[zinx] start event loop err", "err", err)
+		return false
+	}
+	// 3. 保存事件循环, 如果服务器已经关闭, 那么直接释放
+	server.listenerLock.Lock()
+	defer server.listenerLock.Unlock()
+	if server.isStopped() {
+		for _, poller := range pollers {
+			poller.close()
+		}
+		return false
+	}
+	server.pollers = pollers
+	server.Logger.Info("[zinx] event loop started", "count", count)
+	return true
+}
+
+func (server *Server) startMetricsServer() {
+	config := server.GetConfig()
+	if config.ZinxMetricsAddr == "" {
+		return
+	}
+	// 1. 注册指标路由
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler(server))
+	metricsServer := &http.Server{
+		Addr:    config.ZinxMetricsAddr,
+		Handler: mux,
+	}
+	// 2. 保存指标服务器, 如果服务器已经关闭, 那么不再启动
+	server.listenerLock.Lock()
+	if server.isStopped() {
+		server.listenerLock.Unlock()
+		return
+	}
+	server.metricsServer = metricsServer
+	server.listenerLock.Unlock()
+	// 3. 启动
+	go func() {
+		server.Logger.Info("[zinx] metrics server listening", "addr", metricsServer.Addr)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			server.Logger.Error("[zinx] metrics server err", "err", err)
+		}
+	}()
+}
+
+func (server *Server) setListener(listener io.Closer) bool {
+	server.listenerLock.Lock()
+	defer server.listenerLock.Unlock()
+	if server.isStopped() {
+		return false
+	}
+	server.listener = listener
+	return true
+}
+
+func (server *Server) isStopped() bool {
+	select {
+	case <-server.exitChan:
+		return true
+	default:
+		return false
+	}
 }
 
 func (server *Server) AddRouter(id uint32, handler ziface.IHandler) {
 	server.Router.AddHandler(id, handler)
 }
 
+func (server *Server) AddInterceptor(interceptors ...ziface.Interceptor) {
+	server.Router.AddInterceptor(interceptors...)
+}
+
+func (server *Server) AddRouterInterceptor(id uint32, interceptors ...ziface.Interceptor) {
+	server.Router.AddHandlerInterceptor(id, interceptors...)
+}
+
+func (server *Server) GetConfig() *utils.Configuration {
+	return server.config.Load()
+}
+
 func (server *Server) GetConnManager() ziface.IConnManager {
 	return server.ConnManager
 }
 
+func (server *Server) SetTLSConfig(config *tls.Config) {
+	server.TLSConfig = config
+}
+
+func (server *Server) GetMetrics() ziface.IMetrics {
+	return server.Metrics
+}
+
+func (server *Server) SetAuthenticator(authenticator ziface.IAuthenticator) {
+	server.Authenticator = authenticator
+}
+
+func (server *Server) GetAuthenticator() ziface.IAuthenticator {
+	return server.Authenticator
+}
+
+func (server *Server) GetRateLimiter() ziface.IRateLimiter {
+	return server.RateLimiter
+}
+
+func (server *Server) GetMetricsSnapshot() ziface.MetricsSnapshot {
+	snapshot := server.Metrics.Snapshot()
+	snapshot.Connections = server.ConnManager.GetConnectionCount()
+	snapshot.TaskQueueDepths = server.Router.GetTaskQueueDepths()
+	return snapshot
+}
+
+func (server *Server) SetLogger(logger ziface.ILogger) {
+	server.Logger = logger
+	server.Router.SetLogger(logger)
+	server.ConnManager.SetLogger(logger)
+}
+
+func (server *Server) GetLogger() ziface.ILogger {
+	return server.Logger
+}
+
+func (server *Server) SetCodec(codec ziface.ICodec) {
+	server.Codec = codec
+}
+
+func (server *Server) GetCodec() ziface.ICodec {
+	return server.Codec
+}
+
 func (server *Server) GetOnConnStart(connection ziface.IConnection) {
 	if server.OnConnStart != nil {
 		server.OnConnStart(connection)
@@ -107,6 +375,36 @@ func (server *Server) GetOnConnStop(connection ziface.IConnection) {
 	}
 }
 
+func (server *Server) GetOnConnIdle(connection ziface.IConnection) {
+	// 没有设置钩子函数, 默认关闭空闲连接
+	if server.OnConnIdle == nil {
+		connection.GetLogger().Info("[zinx] conn idle timeout, close conn")
+		connection.StopConnWithReason(ErrConnIdle)
+		return
+	}
+	server.OnConnIdle(connection)
+}
+
+func (server *Server) GetOnHandlerTimeout(request ziface.IRequest) {
+	// 没有设置钩子函数, 默认记录日志并回复超时错误
+	if server.OnHandlerTimeout == nil {
+		request.GetConn().GetLogger().Warn("[zinx] handler timeout", "message_id", request.GetMessage().GetMessageID(), "request_id", request.GetRequestID())
+		_ = ReplyError(request, NewStatusError(CodeTimeout, "handler timeout"))
+		return
+	}
+	server.OnHandlerTimeout(request)
+}
+
+func (server *Server) GetOnRateLimited(connection ziface.IConnection, message ziface.IMessage, scope ziface.RateLimitScope) {
+	// 没有设置钩子函数, 默认记录日志
+	if server.OnRateLimited == nil {
+		connection.GetLogger().Warn("[zinx] rate limited", "message_id", message.GetMessageID(), "scope", scope,
+			"action", server.GetConfig().ZinxRateLimitAction)
+		return
+	}
+	server.OnRateLimited(connection, message, scope)
+}
+
 func (server *Server) SetOnConnStart(onConnStart func(connection ziface.IConnection)) {
 	server.OnConnStart = onConnStart
 }
@@ -115,17 +413,71 @@ func (server *Server) SetOnConnStop(onConnStop func(connection ziface.IConnectio
 	server.OnConnStop = onConnStop
 }
 
+func (server *Server) SetOnConnIdle(onConnIdle func(connection ziface.IConnection)) {
+	server.OnConnIdle = onConnIdle
+}
+
+func (server *Server) SetOnHandlerTimeout(onHandlerTimeout func(request ziface.IRequest)) {
+	server.OnHandlerTimeout = onHandlerTimeout
+}
+
+func (server *Server) SetOnRateLimited(onRateLimited func(connection ziface.IConnection, message ziface.IMessage, scope ziface.RateLimitScope)) {
+	server.OnRateLimited = onRateLimited
+}
+
 // NewServer 1. 返回值是 IServer 2. 在方法名前没有声明接受者的, 属于公共的方法
-func NewServer() ziface.IServer {
-	// 变量的声明
+// 没有传入配置相关的选项时使用默认配置, 不会读取任何文件
+func NewServer(options ...Option) (ziface.IServer, error) {
+	// 1. 应用选项
 	server := &Server{
-		Name:        utils.Config.Name,
-		IP:          utils.Config.IP,
-		IPVersion:   utils.Config.IPVersion,
-		Port:        utils.Config.Port,
-		Router:      NewRouter(),
-		ConnManager: NewConnManager(),
+		watchInterval: -1,
+		exitChan:      make(chan struct{}),
+	}
+	server.config.Store(utils.NewConfiguration())
+	for _, option := range options {
+		if err := option(server); err != nil {
+			return nil, err
+		}
+	}
+	// 2. 应用命令行参数并校验配置
+	config := server.GetConfig()
+	if err := server.applyFlags(config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.ZinxCompression != "" && GetCompressor(config.ZinxCompression) == nil {
+		return nil, fmt.Errorf("[zinx] invalid config: ZinxCompression %q is not registered", config.ZinxCompression)
+	}
+	// 3. 根据配置创建组件: 选项中已经设置的组件不再创建
+	server.Name = config.Name
+	server.IP = config.IP
+	server.IPVersion = config.IPVersion
+	server.Port = config.Port
+	server.Router = NewRouter(config)
+	server.ConnManager = NewConnManager()
+	server.ConnManager.SetDuplicateLoginPolicy(config.ZinxDuplicateLogin)
+	server.Metrics = NewMetrics()
+	server.RateLimiter = newRateLimiter(config.ZinxServerRateLimit, config.ZinxServerRateBurst)
+	if server.Codec == nil {
+		server.Codec = NewCodec()
+	}
+	// 记录处理器耗时
+	server.Router.AddInterceptor(MetricsInterceptor(server.Metrics))
+	// 根据配置创建日志
+	if server.Logger == nil {
+		server.Logger = zlog.NewLogger(config.ZinxLogLevel, config.ZinxLogFormat)
+	}
+	server.SetLogger(server.Logger)
+	// 配置了证书则启用 TLS
+	if server.TLSConfig == nil && config.TLSCertFile != "" {
+		tlsConfig, err := NewServerTLSConfig(config.TLSCertFile, config.TLSKeyFile, config.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = tlsConfig
 	}
 	// 接口方法的入参是指针类型, 就需要传入地址, 所以对象需要取址
-	return server
+	return server, nil
 }
@@ -0,0 +1,132 @@
+package znet
+
+import (
+	"context"
+	"flag"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startTestServer 启动监听随机端口的服务器, 返回监听的地址, 测试结束时停止服务器
+func startTestServer(t *testing.T, server *Server) string {
+	t.Helper()
+	if server.IPVersion != "unix" {
+		server.IP, server.Port = "127.0.0.1", 0
+	}
+	server.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = server.Stop(ctx)
+	})
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		server.listenerLock.Lock()
+		listener := server.listener
+		server.listenerLock.Unlock()
+		switch listener := listener.(type) {
+		case net.Listener:
+			return listener.Addr().String()
+		case net.PacketConn:
+			return listener.LocalAddr().String()
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("server not listening")
+	return ""
+}
+
+func TestServerStopFlushesQueuedReplies(t *testing.T) {
+	server := newTestServer(t)
+	started := make(chan struct{}, 2)
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		started <- struct{}{}
+		time.Sleep(50 * time.Millisecond)
+		_ = request.GetConn().Reply(request, request.GetMessage().GetMessageData())
+	}})
+	server.Router.StartWorkerPool()
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	// 1. 第一条请求正在处理, 第二条请求在任务队列中等待
+	writeFrame(t, peer, 1, []byte("first"))
+	writeFrame(t, peer, 1, []byte("second"))
+	<-started
+	for queued(server.Router.(*Router)) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// 2. 停止服务器: 等待任务队列处理完毕, 回复写入之后才关闭连接
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		stopped <- server.Stop(ctx)
+	}()
+	for _, want := range []string{"first", "second"} {
+		if id, data := readFrame(t, peer); id != 1 || string(data) != want {
+			t.Fatalf("reply = %d %q, want %q", id, data, want)
+		}
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("stop err = %v", err)
+	}
+	waitDone(t, conn)
+}
+
+func queued(router *Router) (count int) {
+	for _, depth := range router.GetTaskQueueDepths() {
+		count += depth
+	}
+	return count
+}
+
+func TestWithFlagsRedefined(t *testing.T) {
+	flagSet := flag.NewFlagSet("zinx", flag.ContinueOnError)
+	flagSet.String("port", "", "application port")
+	// 参数名冲突时创建服务器失败, 不会 panic
+	if _, err := NewServer(WithLogger(zlog.NewNopLogger()), WithFlags(flagSet, nil)); err == nil {
+		t.Fatal("server created with redefined flag")
+	}
+}
+
+func TestWithFlagsAndConfig(t *testing.T) {
+	config := utils.NewConfiguration()
+	config.Port = 1000
+	config.ZinxMaxConn = 10
+	// 命令行参数在所有选项之后应用: 和 WithConfig 的顺序无关, 命令行中没有出现的参数使用 WithConfig 的取值
+	for _, flagsFirst := range []bool{true, false} {
+		flagSet := flag.NewFlagSet("zinx", flag.ContinueOnError)
+		options := []Option{WithConfig(config), WithFlags(flagSet, []string{"-port", "2333"})}
+		if flagsFirst {
+			options[0], options[1] = options[1], options[0]
+		}
+		server := newTestServer(t, options...)
+		if server.GetConfig().Port != 2333 || server.GetConfig().ZinxMaxConn != 10 {
+			t.Fatalf("flags first %v: port = %d, max conn = %d", flagsFirst, server.GetConfig().Port, server.GetConfig().ZinxMaxConn)
+		}
+	}
+}
+
+func TestWithFlagsReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zinx.json")
+	if err := os.WriteFile(path, []byte(`{"ZinxMaxConn": 10}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	flagSet := flag.NewFlagSet("zinx", flag.ContinueOnError)
+	server := newTestServer(t, WithConfigFile(path), WithFlags(flagSet, []string{"-max-conn", "20"}))
+	// 重新加载配置文件之后命令行参数仍然优先, 配置文件中的其他字段生效
+	if err := os.WriteFile(path, []byte(`{"ZinxMaxConn": 30, "ZinxIdleTimeout": 5}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if server.GetConfig().ZinxMaxConn != 20 || server.GetConfig().ZinxIdleTimeout != 5 {
+		t.Fatalf("max conn = %d, idle timeout = %d", server.GetConfig().ZinxMaxConn, server.GetConfig().ZinxIdleTimeout)
+	}
+}
@@ -0,0 +1,160 @@
+package znet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert 测试时生成的自签名证书, 同时作为 CA 使用
+type testCert struct {
+	cert tls.Certificate
+	pool *x509.CertPool
+	// PEM 文件路径
+	certFile string
+	keyFile  string
+}
+
+func newTestCert(t *testing.T, commonName string) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	cert := &testCert{
+		cert: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		pool: x509.NewCertPool(),
+	}
+	cert.pool.AddCert(certificate)
+	// 写入 PEM 文件, 测试根据配置加载证书
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	cert.certFile = filepath.Join(dir, commonName+".crt")
+	cert.keyFile = filepath.Join(dir, commonName+".key")
+	_ = os.WriteFile(cert.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(cert.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return cert
+}
+
+// newTLSServer 启动 TLS 服务器: 处理器回复客户端证书的名称, 没有客户端证书时回复 anonymous
+func newTLSServer(t *testing.T, options ...Option) string {
+	t.Helper()
+	server := newTestServer(t, options...)
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		name := "anonymous"
+		if cert := request.GetConn().GetPeerCertificate(); cert != nil {
+			name = cert.Subject.CommonName
+		}
+		_ = request.GetConn().Reply(request, []byte(name))
+	}})
+	return startTestServer(t, server)
+}
+
+func newTLSClient(t *testing.T, address string, config *tls.Config) *Client {
+	t.Helper()
+	client := NewClient("127.0.0.1", 0)
+	client.Address = address
+	client.Logger = zlog.NewNopLogger()
+	client.Reconnect = false
+	client.SetTLSConfig(config)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+func TestTLS(t *testing.T) {
+	serverCert := newTestCert(t, "server")
+	address := newTLSServer(t, WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{serverCert.cert}}))
+	client := newTLSClient(t, address, &tls.Config{RootCAs: serverCert.pool})
+	if err := client.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Call(1, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(response.GetMessageData()) != "anonymous" {
+		t.Fatalf("response = %q", response.GetMessageData())
+	}
+	if cert := client.GetPeerCertificate(); cert == nil || cert.Subject.CommonName != "server" {
+		t.Fatalf("server cert = %v", cert)
+	}
+	// 不信任服务器证书的客户端握手失败
+	untrusted := newTLSClient(t, address, &tls.Config{RootCAs: x509.NewCertPool()})
+	if err := untrusted.Dial(); err == nil {
+		t.Fatal("untrusted server accepted")
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverCert := newTestCert(t, "server")
+	clientCert := newTestCert(t, "alice")
+	// 根据配置中的证书文件启用双向 TLS
+	config := utils.NewConfiguration()
+	config.TLSCertFile = serverCert.certFile
+	config.TLSKeyFile = serverCert.keyFile
+	config.TLSClientCAFile = clientCert.certFile
+	address := newTLSServer(t, WithConfig(config))
+	// 1. 提供证书的客户端: 处理器可以获取客户端证书
+	client := newTLSClient(t, address, &tls.Config{RootCAs: serverCert.pool, Certificates: []tls.Certificate{clientCert.cert}})
+	if err := client.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Call(1, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(response.GetMessageData()) != "alice" {
+		t.Fatalf("response = %q", response.GetMessageData())
+	}
+	// 2. 没有证书的客户端被拒绝: TLS 1.3 在握手之后的第一次读取时返回错误
+	anonymous := newTLSClient(t, address, &tls.Config{RootCAs: serverCert.pool})
+	if err := anonymous.Dial(); err == nil {
+		if _, err := anonymous.Call(1, nil, time.Second); err == nil {
+			t.Fatal("client without cert accepted")
+		}
+	}
+}
+
+func TestTLSConfigLoadError(t *testing.T) {
+	// 证书加载失败时创建服务器失败, 不会退回到明文
+	config := utils.NewConfiguration()
+	config.TLSCertFile = filepath.Join(t.TempDir(), "missing.crt")
+	config.TLSKeyFile = filepath.Join(t.TempDir(), "missing.key")
+	if _, err := NewServer(WithLogger(zlog.NewNopLogger()), WithConfig(config)); err == nil {
+		t.Fatal("server created without certificate")
+	}
+}
@@ -0,0 +1,232 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// 数据报传输的读缓冲区大小: UDP 数据报的最大长度
+const datagramBufferSize = 64 * 1024
+
+// isDatagramNetwork 是否为数据报传输
+func isDatagramNetwork(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return true
+	}
+	return false
+}
+
+// listen 根据网络类型创建流式监听器: TCP 或者 Unix 域套接字
+func (server *Server) listen() (net.Listener, error) {
+	// 1. Unix 域套接字: 删除上一次运行残留的套接字文件
+	if server.IPVersion == "unix" {
+		path := server.GetConfig().UnixSocketPath
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		}
+		return net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	}
+	// 2. 获取 TCP 对象
+	addr, err := net.ResolveTCPAddr(server.IPVersion, fmt.Sprintf("%s:%d", server.IP, server.Port))
+	if err != nil {
+		return nil, err
+	}
+	return net.ListenTCP(server.IPVersion, addr)
+}
+
+// serveDatagram 数据报传输: 每个数据报是一条完整的消息, 同一个客户端地址的数据报属于同一个虚拟连接
+func (server *Server) serveDatagram() {
+	if server.TLSConfig != nil {
+		server.Logger.Error("[zinx] udp network doesn't support tls")
+		return
+	}
+	// 1. 获取 UDP 对象
+	addr, err := net.ResolveUDPAddr(server.IPVersion, fmt.Sprintf("%s:%d", server.IP, server.Port))
+	if err != nil {
+		server.Logger.Error("[zinx] resolve udp addr err", "err", err)
+		return
+	}
+	packetConn, err := net.ListenUDP(server.IPVersion, addr)
+	if err != nil {
+		server.Logger.Error("[zinx] listen err", "ip_version", server.IPVersion, "err", err)
+		return
+	}
+	// 2. 保存监听器, 如果服务器已经关闭, 那么直接释放
+	if !server.setListener(packetConn) {
+		packetConn.Close()
+		return
+	}
+	server.Logger.Info("[zinx] start server success, listening...", "name", server.Name)
+	// 3. 阻塞读取数据报
+	transport := &datagramTransport{
+		server:   server,
+		conn:     packetConn,
+		sessions: make(map[string]*Connection),
+	}
+	transport.serve()
+}
+
+// datagramTransport 数据报传输: 按照客户端地址维护虚拟连接, 同时作为虚拟连接的事件循环
+type datagramTransport struct {
+	server   *Server
+	conn     net.PacketConn
+	connID   uint32
+	sessions map[string]*Connection
+	lock     sync.Mutex
+}
+
+func (transport *datagramTransport) serve() {
+	buf := make([]byte, datagramBufferSize)
+	for {
+		// 1. 读取数据报: 启用空闲检测时每秒唤醒一次
+		idleTimeout := time.Duration(transport.server.GetConfig().ZinxIdleTimeout) * time.Second
+		var readDeadline time.Time
+		if idleTimeout > 0 {
+			readDeadline = time.Now().Add(time.Second)
+		}
+		if err := transport.conn.SetReadDeadline(readDeadline); err != nil {
+			transport.server.Logger.Warn("[zinx] set read deadline err", "err", err)
+		}
+		n, addr, err := transport.conn.ReadFrom(buf)
+		if idleTimeout > 0 {
+			transport.checkIdle(idleTimeout)
+		}
+		if err != nil {
+			if isTimeout(err) {
+				continue
+			}
+			// 监听器关闭后不再读取数据报
+			if transport.server.isStopped() {
+				transport.server.Logger.Info("[zinx] server stop, datagram goroutine exit")
+				return
+			}
+			transport.server.Logger.Warn("[zinx] read datagram err", "err", err)
+			continue
+		}
+		// 2. 获取客户端地址对应的虚拟连接
+		conn := transport.session(addr)
+		if conn == nil {
+			continue
+		}
+		conn.lastRead = time.Now()
+		// 3. 处理数据报中的消息: 不完整的消息直接丢弃
+		consumed, err := conn.decodeMessages(buf[:n])
+		if err == nil && consumed != n {
+			err = errors.New("[zinx] receive incomplete datagram")
+		}
+		if err != nil && err != ErrConnClosed {
+			conn.Logger.Warn("[zinx] drop datagram", "length", n, "err", err)
+		}
+	}
+}
+
+// session 获取客户端地址对应的虚拟连接, 不存在时创建
+func (transport *datagramTransport) session(addr net.Addr) *Connection {
+	key := addr.String()
+	transport.lock.Lock()
+	conn := transport.sessions[key]
+	transport.lock.Unlock()
+	if conn != nil {
+		return conn
+	}
+	// 1. 判断是否已经超过连接上限
+	server := transport.server
+	maxConn := server.GetConfig().ZinxMaxConn
+	if server.ConnManager.GetConnectionCount() >= maxConn {
+		server.Logger.Warn("[zinx] conn count already up to max, drop datagram", "max_conn", maxConn, "remote_addr", key)
+		return nil
+	}
+	// 2. 创建虚拟连接: 每条消息单独发送一个数据报, 不能合并写入
+	transport.connID++
+	conn = NewConn(transport.connID, &datagramConn{conn: transport.conn, addr: addr}, server.Router, server)
+	conn.poller = transport
+	conn.WriteBatchSize = 1
+	transport.lock.Lock()
+	transport.sessions[key] = conn
+	transport.lock.Unlock()
+	conn.StartConn()
+	return conn
+}
+
+// checkIdle 对超过空闲时间没有收到数据报的虚拟连接执行空闲回调
+func (transport *datagramTransport) checkIdle(idleTimeout time.Duration) {
+	// 1. 复制连接列表: 空闲回调可能关闭连接
+	now := time.Now()
+	var idles []*Connection
+	transport.lock.Lock()
+	for _, conn := range transport.sessions {
+		if now.Sub(conn.lastRead) >= idleTimeout {
+			idles = append(idles, conn)
+		}
+	}
+	transport.lock.Unlock()
+	// 2. 执行回调, 重新开始计算空闲时间
+	for _, conn := range idles {
+		conn.lastRead = now
+		conn.Server.GetOnConnIdle(conn)
+	}
+}
+
+func (transport *datagramTransport) add(conn *Connection) error {
+	// 虚拟连接在收到数据报时已经注册
+	conn.lastRead = time.Now()
+	return nil
+}
+
+func (transport *datagramTransport) remove(conn *Connection) {
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+	key := conn.RemoteAddr().String()
+	if transport.sessions[key] == conn {
+		delete(transport.sessions, key)
+	}
+}
+
+func (transport *datagramTransport) close() {
+	// 监听器由服务器关闭
+}
+
+// datagramConn 虚拟连接: 写入时向客户端地址发送一个数据报, 关闭时不影响共享的监听器
+type datagramConn struct {
+	conn net.PacketConn
+	addr net.Addr
+}
+
+func (conn *datagramConn) Read(buf []byte) (int, error) {
+	return 0, errors.New("[zinx] datagram conn is read by transport")
+}
+
+func (conn *datagramConn) Write(buf []byte) (int, error) {
+	return conn.conn.WriteTo(buf, conn.addr)
+}
+
+func (conn *datagramConn) Close() error {
+	return nil
+}
+
+func (conn *datagramConn) LocalAddr() net.Addr {
+	return conn.conn.LocalAddr()
+}
+
+func (conn *datagramConn) RemoteAddr() net.Addr {
+	return conn.addr
+}
+
+func (conn *datagramConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (conn *datagramConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (conn *datagramConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
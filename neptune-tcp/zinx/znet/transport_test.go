@@ -0,0 +1,110 @@
+package znet
+
+import (
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/utils"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// newEchoServer 创建回显服务器, 记录连接关闭的原因
+func newEchoServer(t *testing.T, config *utils.Configuration) (*Server, chan error) {
+	t.Helper()
+	server := newTestServer(t, WithConfig(config))
+	stops := make(chan error, 4)
+	server.SetOnConnStop(func(connection ziface.IConnection) {
+		stops <- connection.GetCloseReason()
+	})
+	server.AddRouter(1, &testHandler{handle: func(request ziface.IRequest) {
+		_ = request.GetConn().Reply(request, request.GetMessage().GetMessageData())
+	}})
+	return server, stops
+}
+
+func TestUnixTransport(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix socket not supported")
+	}
+	config := utils.NewConfiguration()
+	config.IPVersion = "unix"
+	config.UnixSocketPath = filepath.Join(t.TempDir(), "zinx.sock")
+	server, _ := newEchoServer(t, config)
+	address := startTestServer(t, server)
+	client, err := net.Dial("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	writeFrame(t, client, 1, []byte("ping"))
+	if id, data := readFrame(t, client); id != 1 || string(data) != "ping" {
+		t.Fatalf("reply = %d %q", id, data)
+	}
+}
+
+// readDatagram 读取一个数据报并按照默认编解码器解码
+func readDatagram(t *testing.T, client net.Conn) (uint32, []byte) {
+	t.Helper()
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, datagramBufferSize)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := NewCodec().Decode(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message.GetMessageID(), buf[NewCodec().GetHeadLength():n]
+}
+
+func TestUDPTransport(t *testing.T) {
+	config := utils.NewConfiguration()
+	config.IPVersion = "udp4"
+	config.ZinxIdleTimeout = 1
+	server, stops := newEchoServer(t, config)
+	address := startTestServer(t, server)
+	client, err := net.Dial("udp4", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// 1. 每个数据报是一条完整的消息, 同一个客户端地址属于同一个虚拟连接
+	for _, data := range []string{"ping", "pong"} {
+		writeFrame(t, client, 1, []byte(data))
+		if id, reply := readDatagram(t, client); id != 1 || string(reply) != data {
+			t.Fatalf("reply = %d %q", id, reply)
+		}
+	}
+	if count := server.GetConnManager().GetConnectionCount(); count != 1 {
+		t.Fatalf("connection count = %d", count)
+	}
+	// 2. 没有数据报的虚拟连接在空闲超时后释放
+	select {
+	case reason := <-stops:
+		if !errors.Is(reason, ErrConnIdle) {
+			t.Fatalf("reason = %v", reason)
+		}
+	case <-time.After(4 * time.Second):
+		t.Fatal("idle session not evicted")
+	}
+	if count := server.GetConnManager().GetConnectionCount(); count != 0 {
+		t.Fatalf("connection count = %d", count)
+	}
+	// 3. 释放之后再次发送数据报创建新的虚拟连接
+	writeFrame(t, client, 1, []byte("again"))
+	if _, reply := readDatagram(t, client); string(reply) != "again" {
+		t.Fatalf("reply = %q", reply)
+	}
+}
+
+func TestUDPRequiresIdleTimeout(t *testing.T) {
+	config := utils.NewConfiguration()
+	config.IPVersion = "udp4"
+	if _, err := NewServer(WithConfig(config)); err == nil {
+		t.Fatal("udp server created without idle timeout")
+	}
+}
@@ -0,0 +1,208 @@
+package znet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"neptune-golang/neptune-tcp/zinx/ziface"
+	"time"
+)
+
+// ErrorFlag 消息 ID 的次高位: 表示响应是错误信息, 消息内容是 JSON 格式的 StatusError
+const ErrorFlag uint32 = 1 << 30
+
+// ErrBadRequest 请求无法反序列化: 包装反序列化的原始错误后交给错误映射
+var ErrBadRequest = errors.New("[zinx] typed handler bad request")
+
+// 类型化路由的错误码
+const (
+	// CodeBadRequest 请求无法反序列化
+	CodeBadRequest uint32 = 400
+	// CodeInternal 处理器返回的错误不是 StatusError, 或者响应无法序列化
+	CodeInternal uint32 = 500
+	// CodeTimeout 处理超时
+	CodeTimeout uint32 = 504
+)
+
+// StatusError 携带错误码的错误: 类型化路由的处理器返回后发送给客户端
+type StatusError struct {
+	Code    uint32 `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewStatusError(code uint32, message string) *StatusError {
+	return &StatusError{
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("[zinx] status error code %d: %s", err.Code, err.Message)
+}
+
+// DefaultErrorMapper 默认的错误映射: StatusError 原样返回, 其他错误不暴露细节
+// 请求无法反序列化时返回 CodeBadRequest, 其他错误统一返回 CodeInternal
+func DefaultErrorMapper(err error) *StatusError {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr
+	}
+	if errors.Is(err, ErrBadRequest) {
+		return NewStatusError(CodeBadRequest, "bad request")
+	}
+	return NewStatusError(CodeInternal, "internal error")
+}
+
+// typedOptions 类型化路由的选项
+type typedOptions struct {
+	serializer  ziface.ISerializer
+	errorMapper func(err error) *StatusError
+}
+
+// TypedOption 类型化路由的选项
+type TypedOption func(options *typedOptions)
+
+// WithSerializer 设置序列化器, 默认使用 JSON
+func WithSerializer(serializer ziface.ISerializer) TypedOption {
+	return func(options *typedOptions) {
+		options.serializer = serializer
+	}
+}
+
+// WithErrorMapper 设置处理器返回的错误转换为 StatusError 的方式, 默认使用 DefaultErrorMapper
+func WithErrorMapper(errorMapper func(err error) *StatusError) TypedOption {
+	return func(options *typedOptions) {
+		options.errorMapper = errorMapper
+	}
+}
+
+func newTypedOptions(options []TypedOption) *typedOptions {
+	typed := &typedOptions{
+		serializer:  NewJSONSerializer(),
+		errorMapper: DefaultErrorMapper,
+	}
+	for _, option := range options {
+		option(typed)
+	}
+	return typed
+}
+
+// requestContextKey 上下文中保存请求的键
+type requestContextKey struct{}
+
+// ContextWithRequest 在上下文中保存请求, 类型化路由的处理器通过 RequestFromContext 获取连接
+func ContextWithRequest(ctx context.Context, request ziface.IRequest) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, request)
+}
+
+// RequestFromContext 获取上下文中保存的请求
+func RequestFromContext(ctx context.Context) (ziface.IRequest, bool) {
+	request, ok := ctx.Value(requestContextKey{}).(ziface.IRequest)
+	return request, ok
+}
+
+// typedHandler 类型化处理器: 反序列化请求, 调用处理函数, 序列化响应后回复
+type typedHandler[Req any, Resp any] struct {
+	BaseHandler
+	handle  func(ctx context.Context, request *Req) (*Resp, error)
+	options *typedOptions
+}
+
+func (handler *typedHandler[Req, Resp]) Handle(request ziface.IRequest) {
+	// 1. 反序列化请求
+	req := new(Req)
+	if err := handler.options.serializer.Unmarshal(request.GetMessage().GetMessageData(), req); err != nil {
+		request.GetConn().GetLogger().Debug("[zinx] typed handler unmarshal request err", "message_id", request.GetMessage().GetMessageID(), "err", err)
+		_ = ReplyError(request, handler.options.errorMapper(fmt.Errorf("%w: %w", ErrBadRequest, err)))
+		return
+	}
+	// 2. 调用处理函数
+	resp, err := handler.handle(ContextWithRequest(request.Context(), request), req)
+	if err != nil {
+		request.GetConn().GetLogger().Debug("[zinx] typed handler err", "message_id", request.GetMessage().GetMessageID(), "err", err)
+		_ = ReplyError(request, handler.options.errorMapper(err))
+		return
+	}
+	// 3. 没有响应时不回复
+	if resp == nil {
+		return
+	}
+	// 4. 序列化响应后回复
+	data, err := handler.options.serializer.Marshal(resp)
+	if err != nil {
+		request.GetConn().GetLogger().Error("[zinx] typed handler marshal response err", "message_id", request.GetMessage().GetMessageID(), "err", err)
+		_ = ReplyError(request, NewStatusError(CodeInternal, "internal error"))
+		return
+	}
+	if err := request.GetConn().Reply(request, data); err != nil {
+		request.GetConn().GetLogger().Warn("[zinx] typed handler reply err", "message_id", request.GetMessage().GetMessageID(), "err", err)
+	}
+}
+
+// ReplyError 使用带有错误标志的消息 ID 回复错误, 携带请求的序列号; 客户端的 Call 返回 StatusError
+// 请求处理超时之后仍然可以回复一次错误; 请求已经回复时返回 ErrAlreadyReplied
+func ReplyError(request ziface.IRequest, statusErr *StatusError) error {
+	if err := claimErrorReply(request); err != nil {
+		return err
+	}
+	data, err := json.Marshal(statusErr)
+	if err != nil {
+		request.GetConn().GetLogger().Error("[zinx] marshal status error err", "err", err)
+		return err
+	}
+	message := NewMessage(request.GetMessage().GetMessageID()|ErrorFlag, nil)
+	message.SetRequestID(request.GetRequestID())
+	errorRequest := &Request{
+		Message: message,
+		Conn:    request.GetConn(),
+	}
+	if err := request.GetConn().Reply(errorRequest, data); err != nil {
+		request.GetConn().GetLogger().Warn("[zinx] reply status error err", "message_id", request.GetMessage().GetMessageID(), "err", err)
+		return err
+	}
+	return nil
+}
+
+// parseStatusError 解析带有错误标志的响应, 不是错误响应时返回 nil
+func parseStatusError(message ziface.IMessage) error {
+	if message.GetMessageID()&ErrorFlag == 0 {
+		return nil
+	}
+	statusErr := &StatusError{}
+	if err := json.Unmarshal(message.GetMessageData(), statusErr); err != nil {
+		return err
+	}
+	return statusErr
+}
+
+// AddTypedRouter 添加类型化处理器: 请求和响应由序列化器自动转换, 处理函数返回的错误按照错误映射回复给客户端
+// 处理函数返回的响应为空时不回复
+func AddTypedRouter[Req any, Resp any](server ziface.IServer, id uint32, handle func(ctx context.Context, request *Req) (*Resp, error), options ...TypedOption) {
+	server.AddRouter(id, &typedHandler[Req, Resp]{
+		handle:  handle,
+		options: newTypedOptions(options),
+	})
+}
+
+// CallTyped 类型化调用: 序列化请求后调用服务器, 反序列化响应; 服务器返回错误时返回 *StatusError
+func CallTyped[Req any, Resp any](client *Client, id uint32, request *Req, timeout time.Duration, options ...TypedOption) (*Resp, error) {
+	typed := newTypedOptions(options)
+	// 1. 序列化请求
+	data, err := typed.serializer.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	// 2. 调用服务器
+	message, err := client.Call(id, data, timeout)
+	if err != nil {
+		return nil, err
+	}
+	// 3. 反序列化响应
+	resp := new(Resp)
+	if err := typed.serializer.Unmarshal(message.GetMessageData(), resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,173 @@
+package znet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"neptune-golang/neptune-tcp/zinx/zlog"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type echoRequest struct {
+	Text string `json:"text"`
+}
+
+type echoResponse struct {
+	Text string `json:"text"`
+}
+
+// newTypedServer 创建服务器并添加类型化的回显处理器: 内容为空时返回 CodeBadRequest, 内容为 fail 时返回普通错误
+func newTypedServer(t *testing.T, options ...TypedOption) *Server {
+	t.Helper()
+	server := newTestServer(t)
+	AddTypedRouter(server, 1, func(ctx context.Context, request *echoRequest) (*echoResponse, error) {
+		switch request.Text {
+		case "":
+			return nil, NewStatusError(CodeBadRequest, "text is empty")
+		case "fail":
+			return nil, errors.New("database password leaked")
+		}
+		if _, ok := RequestFromContext(ctx); !ok {
+			return nil, errors.New("request not in context")
+		}
+		return &echoResponse{Text: request.Text}, nil
+	}, options...)
+	return server
+}
+
+// startWorkers 启动工作协程, 测试结束时停止
+func startWorkers(t *testing.T, server *Server) {
+	t.Helper()
+	server.Router.StartWorkerPool()
+	t.Cleanup(func() {
+		_ = server.Router.StopWorkerPool(context.Background())
+	})
+}
+
+// readStatusError 对端读取一帧错误响应
+func readStatusError(t *testing.T, id uint32, data []byte) *StatusError {
+	t.Helper()
+	if id&ErrorFlag == 0 {
+		t.Fatalf("reply id = %#x, want error flag", id)
+	}
+	statusErr := &StatusError{}
+	if err := json.Unmarshal(data, statusErr); err != nil {
+		t.Fatal(err)
+	}
+	return statusErr
+}
+
+func TestAddTypedRouter(t *testing.T) {
+	server := newTypedServer(t)
+	startWorkers(t, server)
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	// 1. 正常响应
+	writeFrame(t, peer, 1, []byte(`{"text":"zinx"}`))
+	if id, data := readFrame(t, peer); id != 1 || string(data) != `{"text":"zinx"}` {
+		t.Fatalf("reply = %#x %s", id, data)
+	}
+	// 2. 处理器返回 StatusError: 原样回复
+	writeFrame(t, peer, 1, []byte(`{}`))
+	id, data := readFrame(t, peer)
+	if statusErr := readStatusError(t, id, data); statusErr.Code != CodeBadRequest || statusErr.Message != "text is empty" {
+		t.Fatalf("status error = %+v", statusErr)
+	}
+	// 3. 处理器返回普通错误: 不暴露细节
+	writeFrame(t, peer, 1, []byte(`{"text":"fail"}`))
+	id, data = readFrame(t, peer)
+	if statusErr := readStatusError(t, id, data); statusErr.Code != CodeInternal || strings.Contains(statusErr.Message, "password") {
+		t.Fatalf("status error = %+v", statusErr)
+	}
+	// 4. 请求无法反序列化: 不暴露反序列化的原始错误
+	writeFrame(t, peer, 1, []byte(`{"text":`))
+	id, data = readFrame(t, peer)
+	if statusErr := readStatusError(t, id, data); statusErr.Code != CodeBadRequest || statusErr.Message != "bad request" {
+		t.Fatalf("status error = %+v", statusErr)
+	}
+}
+
+func TestTypedRouterErrorMapper(t *testing.T) {
+	var mapped []error
+	server := newTypedServer(t, WithErrorMapper(func(err error) *StatusError {
+		mapped = append(mapped, err)
+		if errors.Is(err, ErrBadRequest) {
+			return NewStatusError(422, "unprocessable")
+		}
+		return NewStatusError(503, err.Error())
+	}))
+	startWorkers(t, server)
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	// 1. 处理器返回的错误交给错误映射
+	writeFrame(t, peer, 1, []byte(`{"text":"fail"}`))
+	id, data := readFrame(t, peer)
+	if statusErr := readStatusError(t, id, data); statusErr.Code != 503 || statusErr.Message != "database password leaked" {
+		t.Fatalf("status error = %+v", statusErr)
+	}
+	// 2. 反序列化的错误同样交给错误映射, 可以获取原始错误
+	writeFrame(t, peer, 1, []byte(`not json`))
+	id, data = readFrame(t, peer)
+	if statusErr := readStatusError(t, id, data); statusErr.Code != 422 {
+		t.Fatalf("status error = %+v", statusErr)
+	}
+	var syntaxErr *json.SyntaxError
+	if len(mapped) != 2 || !errors.As(mapped[1], &syntaxErr) {
+		t.Fatalf("mapped = %v", mapped)
+	}
+}
+
+func TestCallTyped(t *testing.T) {
+	server := newTypedServer(t)
+	address := startTestServer(t, server)
+	client := NewClient("127.0.0.1", 0)
+	client.Address = address
+	client.Logger = zlog.NewNopLogger()
+	if err := client.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// 1. 正常响应
+	resp, err := CallTyped[echoRequest, echoResponse](client, 1, &echoRequest{Text: "zinx"}, time.Second)
+	if err != nil || resp.Text != "zinx" {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	// 2. 服务器返回错误: 返回 StatusError
+	_, err = CallTyped[echoRequest, echoResponse](client, 1, &echoRequest{}, time.Second)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != CodeBadRequest {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestTypedRouterProtobuf(t *testing.T) {
+	server := newTestServer(t)
+	AddTypedRouter(server, 1, func(ctx context.Context, request *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		return wrapperspb.String(strings.ToUpper(request.GetValue())), nil
+	}, WithSerializer(NewProtobufSerializer()))
+	startWorkers(t, server)
+	conn, peer := newPeerConn(server, 1)
+	conn.StartConn()
+	defer conn.StopConn()
+	// 1. 请求和响应使用 protobuf 序列化
+	data, _ := proto.Marshal(wrapperspb.String("zinx"))
+	writeFrame(t, peer, 1, data)
+	id, data := readFrame(t, peer)
+	resp := &wrapperspb.StringValue{}
+	if err := proto.Unmarshal(data, resp); err != nil || id != 1 || resp.GetValue() != "ZINX" {
+		t.Fatalf("reply = %#x %q, err = %v", id, resp.GetValue(), err)
+	}
+	// 2. 无法反序列化的请求: 错误响应仍然是 JSON 格式
+	writeFrame(t, peer, 1, []byte{0xff})
+	id, data = readFrame(t, peer)
+	if statusErr := readStatusError(t, id, data); statusErr.Code != CodeBadRequest {
+		t.Fatalf("status error = %+v", statusErr)
+	}
+}